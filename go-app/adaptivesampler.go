@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// adaptiveWindow is how often the observed root span rate is re-evaluated.
+const adaptiveWindow = time.Second
+
+// adaptiveSampler samples every trace while the rate of new traces stays
+// under threshold per second. Above it, the ratio drops to threshold/rate so
+// roughly threshold traces per second are still kept, never going below
+// minRatio. The ratio recovers as soon as traffic subsides. It is meant to be
+// used as the root sampler of a ParentBased sampler, so only new traces are
+// counted.
+type adaptiveSampler struct {
+	threshold float64
+	minRatio  float64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+
+	ratio atomic.Uint64 // math.Float64bits of the current ratio
+}
+
+var _ sdktrace.Sampler = (*adaptiveSampler)(nil)
+
+func newAdaptiveSampler(threshold, minRatio float64) (*adaptiveSampler, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("adaptive sampling threshold must be positive, got %v", threshold)
+	}
+	if minRatio < 0 || minRatio > 1 {
+		return nil, fmt.Errorf("adaptive sampling minimum ratio must be in [0,1], got %v", minRatio)
+	}
+	s := &adaptiveSampler{threshold: threshold, minRatio: minRatio, windowStart: time.Now()}
+	s.ratio.Store(math.Float64bits(1))
+	return s, nil
+}
+
+// Ratio returns the sampling ratio currently in effect.
+func (s *adaptiveSampler) Ratio() float64 {
+	return math.Float64frombits(s.ratio.Load())
+}
+
+// observe counts a new trace started at now, first recomputing the ratio if
+// the window has elapsed.
+func (s *adaptiveSampler) observe(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked(now)
+	s.count++
+}
+
+// refresh recomputes the ratio if the window has elapsed by now, so it also
+// recovers while no new trace arrives.
+func (s *adaptiveSampler) refresh(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked(now)
+}
+
+// refreshLocked recomputes the ratio from the traces counted over the whole
+// elapsed time, however few, and starts a new window. s.mu must be held.
+func (s *adaptiveSampler) refreshLocked(now time.Time) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < adaptiveWindow {
+		return
+	}
+
+	rate := float64(s.count) / elapsed.Seconds()
+	ratio := 1.0
+	if rate > s.threshold {
+		ratio = math.Max(s.threshold/rate, s.minRatio)
+	}
+	s.ratio.Store(math.Float64bits(ratio))
+	s.windowStart = now
+	s.count = 0
+}
+
+func (s *adaptiveSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.observe(time.Now())
+
+	// Same trace ID based decision as sdktrace.TraceIDRatioBased
+	bound := uint64(s.Ratio() * (1 << 63))
+	x := binary.BigEndian.Uint64(p.TraceID[8:16]) >> 1
+
+	decision := sdktrace.Drop
+	if x < bound {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *adaptiveSampler) Description() string {
+	return fmt.Sprintf("AdaptiveSampler{threshold=%g/s,min=%g}", s.threshold, s.minRatio)
+}
+
+// registerRatioGauge exposes the current ratio as otel.sampler.effective_ratio.
+func (s *adaptiveSampler) registerRatioGauge() error {
+	_, err := appMeter("go-sample-app/sampler").Float64ObservableGauge(
+		"otel.sampler.effective_ratio",
+		metric.WithDescription("Sampling ratio currently applied to new traces by the adaptive sampler"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			s.refresh(time.Now())
+			o.Observe(s.Ratio())
+			return nil
+		}),
+	)
+	return err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveSamplerRecoversWhileIdle(t *testing.T) {
+	s, err := newAdaptiveSampler(10, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := s.windowStart
+
+	// 100 new traces in the first second, ten times the threshold
+	for i := 0; i < 100; i++ {
+		s.observe(start.Add(time.Duration(i) * time.Millisecond))
+	}
+	s.observe(start.Add(adaptiveWindow))
+	if got := s.Ratio(); got < 0.09 || got > 0.11 {
+		t.Fatalf("Ratio() = %v after a burst of 100/s, want about 0.1", got)
+	}
+
+	// No new trace since, yet the ratio recovers once the window elapses
+	s.refresh(start.Add(2*adaptiveWindow + time.Millisecond))
+	if got := s.Ratio(); got != 1 {
+		t.Errorf("Ratio() = %v after an idle window, want 1", got)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// goWithSpan runs fn in a new goroutine under its own span called name. The
+// goroutine may outlive the request that spawned it, so its span starts a
+// new trace linked to the span in ctx rather than becoming its child, and
+// its context is not cancelled with the request's. The goroutine keeps the
+// pprof labels of ctx and adds async=name, so its samples in the profile
+// still point back at the request.
+func goWithSpan(ctx context.Context, name string, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	tracer := tracerProvider(ctx).Tracer("go-sample-app")
+	link := trace.LinkFromContext(ctx)
+
+	go func() {
+		ctx, span := startSpan(ctx, tracer, name,
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+		)
+		defer span.End()
+
+		pprof.Do(ctx, pprof.Labels("async", name), fn)
+	}()
+}
+
+// asyncFollowUpDelay is how long the follow-up work spawned by the
+// async_work feature flag takes.
+const asyncFollowUpDelay = 50 * time.Millisecond
+
+// simulateAsyncFollowUp stands in for work a handler hands off to finish
+// after the response, like sending a notification.
+func simulateAsyncFollowUp(ctx context.Context) {
+	goWithSpan(ctx, "asyncFollowUp", func(ctx context.Context) {
+		time.Sleep(asyncFollowUpDelay)
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// attrCountProcessor records how many attributes each span was given,
+// including those the SDK dropped for exceeding the span limits. Spans near
+// the limit land in the top buckets before attributes start getting lost.
+type attrCountProcessor struct {
+	counts metric.Int64Histogram
+}
+
+var _ sdktrace.SpanProcessor = (*attrCountProcessor)(nil)
+
+func newAttrCountProcessor() (*attrCountProcessor, error) {
+	// Bucket around the effective limit (OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT)
+	limit := float64(sdktrace.NewSpanLimits().AttributeCountLimit)
+	if limit <= 0 {
+		limit = sdktrace.DefaultAttributeCountLimit
+	}
+
+	counts, err := appMeter("go-sample-app/trace").Int64Histogram(
+		"otel.span.attribute_count",
+		metric.WithDescription("Number of attributes set on each span, including dropped ones"),
+		metric.WithExplicitBucketBoundaries(
+			limit*0.1, limit*0.25, limit*0.5, limit*0.75, limit*0.9, limit,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attrCountProcessor{counts: counts}, nil
+}
+
+func (p *attrCountProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *attrCountProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.counts.Record(context.Background(), int64(len(s.Attributes())+s.DroppedAttributes()))
+}
+
+func (p *attrCountProcessor) Shutdown(context.Context) error   { return nil }
+func (p *attrCountProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// bodyCapture keeps the first maxBytes of every request body so handlers can
+// attach them to their span when the request fails. Successful requests
+// never export their body, which keeps the privacy and volume cost to the
+// requests that need debugging.
+type bodyCapture struct {
+	maxBytes int
+	scrub    *scrubber // nil leaves captured bodies unscrubbed
+}
+
+// capturedBody is the start of a request body, unscrubbed until it is
+// attached to a span.
+type capturedBody struct {
+	data      []byte
+	truncated bool
+	scrub     *scrubber
+}
+
+type capturedBodyContextKey struct{}
+
+// Wrap buffers up to maxBytes of the request body ahead of next, which still
+// reads the whole body.
+func (c *bodyCapture) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Read one byte past the limit to tell a truncated body from one
+		// that fits exactly
+		buf, err := io.ReadAll(io.LimitReader(r.Body, int64(c.maxBytes)+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		if err == nil {
+			body := &capturedBody{data: buf, scrub: c.scrub}
+			if len(buf) > c.maxBytes {
+				body.data, body.truncated = buf[:c.maxBytes], true
+			}
+			r = r.WithContext(context.WithValue(r.Context(), capturedBodyContextKey{}, body))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// capturedBodyAttrs returns the captured request body in ctx as span
+// attributes, scrubbed if configured. It is for failed requests only.
+func capturedBodyAttrs(ctx context.Context) []attribute.KeyValue {
+	body, ok := ctx.Value(capturedBodyContextKey{}).(*capturedBody)
+	if !ok {
+		return nil
+	}
+	v := strings.ToValidUTF8(string(body.data), "�")
+	if body.scrub != nil {
+		v = body.scrub.Scrub(v)
+	}
+	return []attribute.KeyValue{
+		attribute.String("http.request.body.captured", v),
+		attribute.Bool("http.request.body.truncated", body.truncated),
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// codeLocationProcessor records where each span was started as code.filepath,
+// code.lineno and code.function.
+type codeLocationProcessor struct{}
+
+var _ sdktrace.SpanProcessor = codeLocationProcessor{}
+
+func (codeLocationProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		// The first frame outside the SDK is the code that started the span
+		if !strings.HasPrefix(frame.Function, "go.opentelemetry.io/") {
+			s.SetAttributes(
+				semconv.CodeFilepath(frame.File),
+				semconv.CodeLineNumber(frame.Line),
+				semconv.CodeFunction(frame.Function),
+			)
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+func (codeLocationProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (codeLocationProcessor) Shutdown(context.Context) error   { return nil }
+func (codeLocationProcessor) ForceFlush(context.Context) error { return nil }
+
+// codeLocationCore adds code.filepath and code.lineno fields, taken from the
+// caller zap already resolves, to every entry.
+type codeLocationCore struct {
+	zapcore.Core
+}
+
+func newCodeLocationCore(core zapcore.Core) zapcore.Core {
+	return &codeLocationCore{Core: core}
+}
+
+func (c *codeLocationCore) With(fields []zapcore.Field) zapcore.Core {
+	return &codeLocationCore{Core: c.Core.With(fields)}
+}
+
+func (c *codeLocationCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *codeLocationCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Caller.Defined {
+		fields = append(fields,
+			zap.String(string(semconv.CodeFilepathKey), ent.Caller.File),
+			zap.Int(string(semconv.CodeLineNumberKey), ent.Caller.Line),
+		)
+	}
+	return c.Core.Write(ent, fields)
+}
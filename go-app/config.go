@@ -0,0 +1,664 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.uber.org/zap/zapcore"
+)
+
+// Metrics exporters accepted in OTEL_METRICS_EXPORTER.
+const (
+	metricsExporterOTLP       = "otlp"
+	metricsExporterPrometheus = "prometheus"
+)
+
+// Exemplar filters accepted in OTEL_METRICS_EXEMPLAR_FILTER.
+var exemplarFilters = []string{"trace_based", "always_on", "always_off"}
+
+// Config is the service configuration, loaded once at startup by
+// LoadConfig and passed to whatever needs it.
+type Config struct {
+	// ServiceName and ServiceVersion identify the service on every signal.
+	ServiceName    string
+	ServiceVersion string
+
+	// DeploymentEnvironment, e.g. "staging", is reported as
+	// deployment.environment when set.
+	DeploymentEnvironment string
+
+	// ResourceSchemaURL is the semantic conventions schema of the resource.
+	ResourceSchemaURL string
+
+	// ListenAddr is the host:port the HTTP server listens on.
+	ListenAddr string
+
+	// RoutePrefix is mounted in front of every route, probes included.
+	RoutePrefix string
+
+	// ShutdownTimeout bounds draining in-flight requests and flushing
+	// telemetry on exit.
+	ShutdownTimeout time.Duration
+
+	// OTLPProtocol and OTLPEndpoint select how and where telemetry is
+	// exported. The endpoint is a host:port address.
+	OTLPProtocol string
+	OTLPEndpoint string
+
+	// OTLPHeaders are sent with every export.
+	OTLPHeaders map[string]string
+
+	// OTLPEndpointFile and OTLPHeadersFile, when set, name secret files that
+	// take precedence over OTLPEndpoint and OTLPHeaders and are re-read on
+	// SIGHUP.
+	OTLPEndpointFile string
+	OTLPHeadersFile  string
+
+	// OTLPInsecure exports in plaintext. Otherwise exports use TLS, trusting
+	// the system roots plus OTLPCAFile, a PEM bundle, if set.
+	OTLPInsecure bool
+	OTLPCAFile   string
+
+	// MetricsExporter is how metrics leave the app: pushed over OTLP, or
+	// scraped from /metrics by Prometheus.
+	MetricsExporter string
+
+	// MetricInterval is how often metrics are exported.
+	MetricInterval time.Duration
+
+	// MetricViews apply the configured instrument descriptions and units.
+	MetricViews []sdkmetric.View
+
+	// StripMetricAttributes are removed from every metric before export.
+	StripMetricAttributes map[attribute.Key]bool
+
+	// RuntimeMetrics reports Go runtime metrics, reading memory statistics at
+	// most every RuntimeMetricsInterval.
+	RuntimeMetrics         bool
+	RuntimeMetricsInterval time.Duration
+
+	// The batch span processor buffers up to SpanQueueSize ended spans,
+	// dropping new ones when full, and exports them in batches of up to
+	// SpanBatchSize at least every SpanScheduleDelay.
+	SpanQueueSize     int
+	SpanBatchSize     int
+	SpanScheduleDelay time.Duration
+
+	// IDGenerator generates the trace and span IDs of every tracer provider.
+	// Nil keeps the SDK's random generator.
+	IDGenerator sdktrace.IDGenerator
+
+	// Sampling decides which traces are recorded.
+	Sampling SamplingConfig
+
+	// StripSpanAttributes are removed from spans before export. Other span
+	// processors, such as the in-memory recorder, still see them.
+	StripSpanAttributes map[attribute.Key]bool
+
+	// SpanAttributeMaxLength is the length, in characters, past which string
+	// attribute values are truncated before export. Zero disables truncation.
+	SpanAttributeMaxLength int
+
+	// FlushOnError flushes the export processor as soon as a trace with an
+	// error span is complete, so the trace shows up in Tempo without waiting
+	// for the batch timeout.
+	FlushOnError bool
+
+	// CaptureCodeLocation records where every span and log was created.
+	// Walking the stack each time has a cost, so it is off by default.
+	CaptureCodeLocation bool
+
+	// InheritedSpanAttributes are the keys of the attributes that child spans
+	// inherit from their parents, such as tenant.id.
+	InheritedSpanAttributes map[attribute.Key]bool
+
+	// SpanDurationMetrics records the duration of every span as a metric.
+	SpanDurationMetrics bool
+
+	// DynamicAttributesFile, when set, holds attributes added to every span
+	// that can change without a restart. It is re-read on SIGHUP.
+	DynamicAttributesFile string
+
+	// HighFrequencyMetrics are exported every HighFrequencyInterval instead
+	// of every MetricInterval, for real-time panels.
+	HighFrequencyMetrics  map[string]bool
+	HighFrequencyInterval time.Duration
+
+	// Scrub removes the PII matched by ScrubPatterns from logs and spans.
+	Scrub         bool
+	ScrubPatterns []string
+
+	// Logging configures the stdout and OTLP logs.
+	Logging LoggingConfig
+
+	// The startup of the telemetry pipeline: provider setup is retried
+	// StartupRetryAttempts times, backing off from StartupRetryBaseDelay.
+	// With WaitForCollector set, startup first waits up to
+	// WaitForCollectorTimeout for the collector to accept connections, and
+	// with WaitForCollectorStrict stops the app if it never does.
+	StartupRetryAttempts    int
+	StartupRetryBaseDelay   time.Duration
+	WaitForCollector        bool
+	WaitForCollectorTimeout time.Duration
+	WaitForCollectorStrict  bool
+
+	// RedactQueryParams are the query parameters whose values are replaced
+	// before the URL is recorded on spans, keyed by lowercase name.
+	RedactQueryParams map[string]bool
+
+	// SpanNames selects how HTTP server spans are named.
+	SpanNames spanNameFormat
+
+	// RequestTimeoutHeader carries the time an upstream still allows for a
+	// request, and is passed on to the downstream.
+	RequestTimeoutHeader string
+
+	// PeerServices names the simulated upstream of each outbound client
+	// span, keyed by span name.
+	PeerServices map[string]string
+
+	// The simulated /hello workload: SimulatedWait on an external dependency
+	// after the compute loop, zero for none, and a SimulatedErrorRate share
+	// of requests failing with a 500.
+	SimulatedWait      time.Duration
+	SimulatedErrorRate float64
+
+	// DownstreamURL is called by every /hello request, so its trace continues
+	// into another service. Empty disables the call.
+	DownstreamURL string
+
+	// LogLevelMix, when non-empty, makes every request emit one extra log
+	// whose level is drawn from it, for a realistic mix of levels in Loki.
+	LogLevelMix []levelProbability
+
+	// DurationDetail decides per endpoint whether request durations are
+	// recorded in the histogram or only counted.
+	DurationDetail durationDetail
+
+	// DurationQuantilesWindow, when positive, reports request duration
+	// quantiles over a sliding window of that length.
+	DurationQuantilesWindow time.Duration
+
+	// SlowExemplarThreshold is the request duration below which measurements
+	// of http.request.duration offer no exemplar. Zero offers every request.
+	SlowExemplarThreshold time.Duration
+
+	// MaxConcurrentRequests bounds the /hello requests served at once. Zero
+	// leaves them unbounded.
+	MaxConcurrentRequests int
+
+	// Requests repeating an Idempotency-Key seen in the last
+	// IdempotencyWindow are counted as retries. At most IdempotencyMaxKeys
+	// keys are remembered.
+	IdempotencyWindow  time.Duration
+	IdempotencyMaxKeys int
+
+	// CacheHitRatio is the share of /cache-demo lookups that hit.
+	CacheHitRatio float64
+
+	// FeatureFlags are on for every request, unless a request overrides them
+	// in FeatureFlagsHeader.
+	FeatureFlags       featureFlags
+	FeatureFlagsHeader string
+
+	// BodyCapture keeps request bodies for the spans of failed requests.
+	BodyCapture BodyCaptureConfig
+
+	// ConsoleMetricsInterval, when positive, is how often key request
+	// counters are logged to the console.
+	ConsoleMetricsInterval time.Duration
+
+	// Tenant routes each tenant's telemetry to providers of its own.
+	Tenant TenantConfig
+
+	// Readiness configures what /readyz checks.
+	Readiness ReadinessConfig
+
+	// HeapProfile saves heap profiles of requests that allocate a lot.
+	HeapProfile HeapProfileConfig
+
+	// LoadGen generates synthetic traces instead of serving HTTP.
+	LoadGen LoadGenConfig
+
+	// DebugEndpoints serves the /debug endpoints, backed by an in-memory
+	// recorder of up to RecorderMaxTraces traces and RecorderMaxBytes bytes.
+	DebugEndpoints    bool
+	RecorderMaxTraces int
+	RecorderMaxBytes  int
+
+	// DebugPropagationHeaders are the extra request headers the propagation
+	// debug endpoint echoes.
+	DebugPropagationHeaders []string
+
+	// PprofRegionSpans makes every profiled region of a request a span too.
+	PprofRegionSpans bool
+
+	// Pyroscope pushes continuous profiles to the Pyroscope server at
+	// PyroscopeAddr.
+	Pyroscope     bool
+	PyroscopeAddr string
+}
+
+// LoggingConfig configures the stdout and OTLP logs.
+type LoggingConfig struct {
+	// Level is the level of the root logger, and Levels sets those of named
+	// loggers, as in "http=debug,otel=warn".
+	Level  zapcore.Level
+	Levels string
+
+	// TimeFormat is the encoding of log timestamps, one of logTimeEncoders.
+	TimeFormat string
+
+	// TraceAffinity samples logs so that sampled traces keep all of theirs.
+	TraceAffinity bool
+
+	// OTLP exports logs at OTLPMinLevel and above over OTLP as well.
+	OTLP         bool
+	OTLPMinLevel zapcore.Level
+}
+
+// SamplingConfig selects the trace sampler. Sampler and SamplerArg, the
+// standard OTEL_TRACES_SAMPLER settings, exclude Adaptive and Consistent.
+type SamplingConfig struct {
+	Sampler    string
+	SamplerArg string
+
+	// Adaptive lowers the sampling ratio, down to AdaptiveMinRatio, once
+	// root spans exceed AdaptiveThreshold per second.
+	Adaptive          bool
+	AdaptiveThreshold float64
+	AdaptiveMinRatio  float64
+
+	// Consistent samples ConsistentRatio of traces by trace ID, so every hop
+	// reaches the same decision.
+	Consistent      bool
+	ConsistentRatio float64
+
+	// ByMethod overrides the ratio of new traces per HTTP method, as in
+	// "POST:1.0,GET:0.1".
+	ByMethod string
+
+	// ForcePerSecond caps the traces a second forced into the sample by the
+	// force_sample feature flag.
+	ForcePerSecond float64
+
+	// TracestateEntry, in key=value form, is added to the tracestate of
+	// sampled spans.
+	TracestateEntry string
+}
+
+// BodyCaptureConfig configures request body capture. Up to MaxBytes of each
+// body are kept, scrubbed with the PII patterns when Scrub is set.
+type BodyCaptureConfig struct {
+	Enabled  bool
+	MaxBytes int
+	Scrub    bool
+}
+
+// TenantConfig configures per-tenant telemetry. The tenant is read from the
+// Header of each request, and exports to its entry in Endpoints, if any. At
+// most MaxProviders tenants have providers at once, and those idle for
+// IdleTimeout are shut down.
+type TenantConfig struct {
+	Enabled      bool
+	Header       string
+	Endpoints    map[string]string
+	MaxProviders int
+	IdleTimeout  time.Duration
+}
+
+// ReadinessConfig configures /readyz. URLs is a comma-separated list of
+// name=url upstreams, critical unless listed in Optional. Each check is
+// bounded by Timeout. CollectorCritical makes the collector critical.
+type ReadinessConfig struct {
+	CollectorCritical bool
+	URLs              string
+	Optional          string
+	Timeout           time.Duration
+}
+
+// HeapProfileConfig saves a heap profile to Dir for requests allocating more
+// than AllocThreshold bytes, zero for never, keeping the MaxSaved latest.
+type HeapProfileConfig struct {
+	AllocThreshold int
+	Dir            string
+	MaxSaved       int
+}
+
+// LoadGenConfig configures the load generator: TracesPerSecond traces of
+// SpansPerTrace spans, nested up to Depth deep, with attribute values of
+// AttributeSize bytes.
+type LoadGenConfig struct {
+	Enabled         bool
+	TracesPerSecond float64
+	SpansPerTrace   int
+	Depth           int
+	AttributeSize   int
+}
+
+// LoadConfig reads the Config from the environment, applying defaults for
+// unset variables. Set but invalid values are an error rather than silently
+// replaced by the default.
+func LoadConfig() (Config, error) {
+	env := &envReader{}
+
+	protocol, err := parseOTLPProtocol(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	listenAddr := os.Getenv("LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = ":" + env.String("PORT", "8080")
+	}
+
+	// In milliseconds, as the SDK, which reads it too, expects
+	interval := env.Millis("OTEL_METRIC_EXPORT_INTERVAL", time.Second)
+
+	idGenerator, err := parseIDGenerator(os.Getenv("TRACE_ID_GENERATOR"), int64(env.Int("TRACE_ID_SEED", 1)))
+	if err != nil {
+		return Config{}, fmt.Errorf("TRACE_ID_GENERATOR: %w", err)
+	}
+	downstreamURL, err := parseDownstreamURL(os.Getenv("DOWNSTREAM_URL"))
+	if err != nil {
+		return Config{}, fmt.Errorf("DOWNSTREAM_URL: %w", err)
+	}
+	// The SDK reads OTEL_METRICS_EXEMPLAR_FILTER itself, with no option to
+	// pass a filter in, and takes anything it doesn't know for trace_based.
+	// Only the spelling is checked here; Config has no field for it.
+	if v := os.Getenv("OTEL_METRICS_EXEMPLAR_FILTER"); v != "" && !slices.Contains(exemplarFilters, v) {
+		return Config{}, fmt.Errorf("OTEL_METRICS_EXEMPLAR_FILTER %q: want one of %s", v, strings.Join(exemplarFilters, ", "))
+	}
+	logLevelMix, err := parseLogLevelMix(os.Getenv("LOG_LEVEL_PROBABILITIES"))
+	if err != nil {
+		return Config{}, err
+	}
+	otlpHeaders, err := parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	views, err := metadataViews(os.Getenv("METRIC_METADATA"))
+	if err != nil {
+		return Config{}, err
+	}
+	spanNames, err := parseSpanNameFormat(os.Getenv("HTTP_SPAN_NAME_FORMAT"))
+	if err != nil {
+		return Config{}, fmt.Errorf("HTTP_SPAN_NAME_FORMAT: %w", err)
+	}
+	logLevel, err := zapcore.ParseLevel(env.String("LOG_LEVEL", "info"))
+	if err != nil {
+		return Config{}, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	otlpLogLevel, err := zapcore.ParseLevel(env.String("OTLP_LOGS_MIN_LEVEL", "debug"))
+	if err != nil {
+		return Config{}, fmt.Errorf("OTLP_LOGS_MIN_LEVEL: %w", err)
+	}
+
+	cfg := Config{
+		ServiceName:           strings.TrimSpace(env.String("OTEL_SERVICE_NAME", "go-sample-app")),
+		ServiceVersion:        strings.TrimSpace(env.String("SERVICE_VERSION", "1.0.0")),
+		DeploymentEnvironment: strings.TrimSpace(os.Getenv("DEPLOYMENT_ENVIRONMENT")),
+		ResourceSchemaURL:     env.String("OTEL_RESOURCE_SCHEMA_URL", semconv.SchemaURL),
+		ListenAddr:            listenAddr,
+		RoutePrefix:           os.Getenv("ROUTE_PREFIX"),
+		ShutdownTimeout:       env.Duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		OTLPProtocol:     protocol,
+		OTLPEndpoint:     env.String("OTEL_COLLECTOR_ENDPOINT", defaultOTLPEndpoint(protocol)),
+		OTLPHeaders:      otlpHeaders,
+		OTLPEndpointFile: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT_FILE"),
+		OTLPHeadersFile:  os.Getenv("OTEL_EXPORTER_OTLP_HEADERS_FILE"),
+		OTLPInsecure:     env.Bool("OTEL_EXPORTER_OTLP_INSECURE", true),
+		OTLPCAFile:       os.Getenv("OTEL_EXPORTER_OTLP_CA_FILE"),
+
+		MetricsExporter:        strings.ToLower(strings.TrimSpace(env.String("OTEL_METRICS_EXPORTER", metricsExporterOTLP))),
+		MetricInterval:         interval,
+		MetricViews:            views,
+		StripMetricAttributes:  parseAttributeKeys(os.Getenv("EXPORT_STRIP_METRIC_ATTRIBUTES")),
+		RuntimeMetrics:         env.Bool("RUNTIME_METRICS_ENABLED", true),
+		RuntimeMetricsInterval: env.Duration("RUNTIME_METRICS_INTERVAL", interval),
+		HighFrequencyMetrics:   parseMetricNames(os.Getenv("HIGH_FREQUENCY_METRICS")),
+		HighFrequencyInterval:  env.Duration("HIGH_FREQUENCY_INTERVAL", 250*time.Millisecond),
+
+		SpanQueueSize:     env.Int("OTEL_BSP_MAX_QUEUE_SIZE", sdktrace.DefaultMaxQueueSize),
+		SpanBatchSize:     env.Int("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", sdktrace.DefaultMaxExportBatchSize),
+		SpanScheduleDelay: env.Millis("OTEL_BSP_SCHEDULE_DELAY", sdktrace.DefaultScheduleDelay*time.Millisecond),
+		IDGenerator:       idGenerator,
+		Sampling: SamplingConfig{
+			Sampler:           os.Getenv("OTEL_TRACES_SAMPLER"),
+			SamplerArg:        os.Getenv("OTEL_TRACES_SAMPLER_ARG"),
+			Adaptive:          env.Bool("ADAPTIVE_SAMPLING_ENABLED", false),
+			AdaptiveThreshold: env.Float("ADAPTIVE_SAMPLING_THRESHOLD", 50),
+			AdaptiveMinRatio:  env.Float("ADAPTIVE_SAMPLING_MIN_RATIO", 0.01),
+			Consistent:        os.Getenv("CONSISTENT_SAMPLING_RATIO") != "",
+			ConsistentRatio:   env.Float("CONSISTENT_SAMPLING_RATIO", 1),
+			ByMethod:          os.Getenv("SAMPLING_RATIO_BY_METHOD"),
+			ForcePerSecond:    env.Float("FORCE_SAMPLE_PER_SECOND", 10),
+			TracestateEntry:   os.Getenv("TRACESTATE_ENTRY"),
+		},
+
+		StripSpanAttributes:     parseAttributeKeys(os.Getenv("EXPORT_STRIP_SPAN_ATTRIBUTES")),
+		SpanAttributeMaxLength:  env.Int("SPAN_ATTRIBUTE_MAX_LENGTH", 0),
+		FlushOnError:            env.Bool("FLUSH_ON_ERROR", false),
+		CaptureCodeLocation:     env.Bool("CAPTURE_CODE_LOCATION", false),
+		InheritedSpanAttributes: parseAttributeKeys(env.String("INHERITED_SPAN_ATTRIBUTES", "tenant.id")),
+		SpanDurationMetrics:     env.Bool("SPAN_DURATION_METRICS", false),
+		DynamicAttributesFile:   os.Getenv("DYNAMIC_ATTRIBUTES_FILE"),
+
+		Scrub:         env.Bool("SCRUB_ENABLED", true),
+		ScrubPatterns: parseScrubPatterns(os.Getenv("SCRUB_PATTERNS")),
+		Logging: LoggingConfig{
+			Level:         logLevel,
+			Levels:        os.Getenv("LOG_LEVELS"),
+			TimeFormat:    strings.ToLower(env.String("LOG_TIME_FORMAT", "iso8601")),
+			TraceAffinity: env.Bool("LOG_SAMPLING_TRACE_AFFINITY", true),
+			OTLP:          env.Bool("OTLP_LOGS_ENABLED", true),
+			OTLPMinLevel:  otlpLogLevel,
+		},
+
+		StartupRetryAttempts:    env.Int("STARTUP_RETRY_ATTEMPTS", 5),
+		StartupRetryBaseDelay:   env.Duration("STARTUP_RETRY_BASE_DELAY", 500*time.Millisecond),
+		WaitForCollector:        env.Bool("WAIT_FOR_COLLECTOR", false),
+		WaitForCollectorTimeout: env.Duration("WAIT_FOR_COLLECTOR_TIMEOUT", 30*time.Second),
+		WaitForCollectorStrict:  env.Bool("WAIT_FOR_COLLECTOR_STRICT", true),
+
+		RedactQueryParams:       parseQueryParamDenylist(os.Getenv("QUERY_REDACT_PARAMS")),
+		SpanNames:               spanNames,
+		RequestTimeoutHeader:    env.String("REQUEST_TIMEOUT_HEADER", defaultRequestTimeoutHeader),
+		PeerServices:            parsePeerServices(os.Getenv("PEER_SERVICES")),
+		SimulatedWait:           env.Duration("SIMULATED_WAIT", 0),
+		SimulatedErrorRate:      env.Float("SIMULATED_ERROR_RATE", 0),
+		DownstreamURL:           downstreamURL,
+		LogLevelMix:             logLevelMix,
+		DurationDetail:          parseDurationDetail(os.Getenv("ENDPOINT_DURATION_DETAIL")),
+		DurationQuantilesWindow: env.Duration("DURATION_QUANTILES_WINDOW", 0),
+		SlowExemplarThreshold:   env.Duration("EXEMPLAR_LATENCY_THRESHOLD", 0),
+		MaxConcurrentRequests:   env.Int("MAX_CONCURRENT_REQUESTS", 0),
+		IdempotencyWindow:       env.Duration("IDEMPOTENCY_WINDOW", 10*time.Minute),
+		IdempotencyMaxKeys:      env.Int("IDEMPOTENCY_MAX_KEYS", 10000),
+		CacheHitRatio:           env.Float("CACHE_DEMO_HIT_RATIO", 0.8),
+		FeatureFlags:            parseFeatureFlags(os.Getenv("FEATURE_FLAGS")),
+		FeatureFlagsHeader:      env.String("FEATURE_FLAGS_HEADER", "X-Feature-Flags"),
+		BodyCapture: BodyCaptureConfig{
+			Enabled:  env.Bool("BODY_CAPTURE_ENABLED", false),
+			MaxBytes: env.Int("BODY_CAPTURE_MAX_BYTES", 1024),
+			Scrub:    env.Bool("BODY_CAPTURE_SCRUB", true),
+		},
+		ConsoleMetricsInterval: env.Duration("CONSOLE_METRICS_INTERVAL", 0),
+
+		Tenant: TenantConfig{
+			Enabled:      env.Bool("TENANT_ENABLED", false),
+			Header:       env.String("TENANT_HEADER", "X-Tenant-ID"),
+			Endpoints:    parseTenantEndpoints(os.Getenv("TENANT_ENDPOINTS")),
+			MaxProviders: env.Int("TENANT_MAX_PROVIDERS", 10),
+			IdleTimeout:  env.Duration("TENANT_IDLE_TIMEOUT", 5*time.Minute),
+		},
+		Readiness: ReadinessConfig{
+			CollectorCritical: env.Bool("READINESS_COLLECTOR_CRITICAL", true),
+			URLs:              os.Getenv("READINESS_URLS"),
+			Optional:          os.Getenv("READINESS_OPTIONAL"),
+			Timeout:           env.Duration("READINESS_TIMEOUT", 2*time.Second),
+		},
+		HeapProfile: HeapProfileConfig{
+			AllocThreshold: env.Int("HEAP_PROFILE_ALLOC_THRESHOLD", 0),
+			Dir:            env.String("HEAP_PROFILE_DIR", filepath.Join(os.TempDir(), "heap-profiles")),
+			MaxSaved:       env.Int("HEAP_PROFILE_MAX_SAVED", 20),
+		},
+		LoadGen: LoadGenConfig{
+			Enabled:         env.Bool("LOADGEN_ENABLED", false),
+			TracesPerSecond: env.Float("LOADGEN_TRACES_PER_SECOND", 10),
+			SpansPerTrace:   env.Int("LOADGEN_SPANS_PER_TRACE", 10),
+			Depth:           env.Int("LOADGEN_DEPTH", 3),
+			AttributeSize:   env.Int("LOADGEN_ATTRIBUTE_SIZE", 64),
+		},
+
+		DebugEndpoints:          env.Bool("DEBUG_ENDPOINTS", false),
+		RecorderMaxTraces:       env.Int("RECORDER_MAX_TRACES", defaultRecorderMaxTraces),
+		RecorderMaxBytes:        env.Int("RECORDER_MAX_BYTES", defaultRecorderMaxBytes),
+		DebugPropagationHeaders: parseHeaderNames(os.Getenv("DEBUG_PROPAGATION_HEADERS")),
+		PprofRegionSpans:        env.Bool("PPROF_REGION_SPANS", false),
+		Pyroscope:               env.Bool("PYROSCOPE_ENABLED", true),
+		PyroscopeAddr:           env.String("PYROSCOPE_SERVER_ADDRESS", "http://localhost:4040"),
+	}
+	if env.err != nil {
+		return Config{}, env.err
+	}
+	return cfg, cfg.validate()
+}
+
+func (c Config) validate() error {
+	if c.ServiceName == "" {
+		return errors.New("OTEL_SERVICE_NAME must not be empty")
+	}
+	if c.ServiceVersion == "" {
+		return errors.New("SERVICE_VERSION must not be empty")
+	}
+	if err := validateHostPort(c.ListenAddr); err != nil {
+		return fmt.Errorf("listen address %q: %w", c.ListenAddr, err)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must be positive, got %s", c.ShutdownTimeout)
+	}
+	if path, ok := unixSocketPath(c.OTLPEndpoint); ok {
+		if c.OTLPProtocol != otlpProtocolGRPC {
+			return fmt.Errorf("OTEL_COLLECTOR_ENDPOINT %q: unix sockets require OTEL_EXPORTER_OTLP_PROTOCOL=%s", c.OTLPEndpoint, otlpProtocolGRPC)
+		}
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("OTEL_COLLECTOR_ENDPOINT %q: want an absolute socket path, e.g. unix:///var/run/otlp.sock", c.OTLPEndpoint)
+		}
+	} else if err := validateHostPort(c.OTLPEndpoint); err != nil {
+		return fmt.Errorf("OTEL_COLLECTOR_ENDPOINT %q: %w", c.OTLPEndpoint, err)
+	}
+	if c.OTLPInsecure && c.OTLPCAFile != "" {
+		return errors.New("OTEL_EXPORTER_OTLP_CA_FILE requires OTEL_EXPORTER_OTLP_INSECURE=false")
+	}
+	if c.MetricsExporter != metricsExporterOTLP && c.MetricsExporter != metricsExporterPrometheus {
+		return fmt.Errorf("OTEL_METRICS_EXPORTER %q: want %q or %q", c.MetricsExporter, metricsExporterOTLP, metricsExporterPrometheus)
+	}
+	if c.MetricInterval <= 0 {
+		return fmt.Errorf("metric interval must be positive, got %s", c.MetricInterval)
+	}
+	if c.SpanQueueSize <= 0 {
+		return fmt.Errorf("OTEL_BSP_MAX_QUEUE_SIZE must be positive, got %d", c.SpanQueueSize)
+	}
+	if c.SpanBatchSize <= 0 || c.SpanBatchSize > c.SpanQueueSize {
+		return fmt.Errorf("OTEL_BSP_MAX_EXPORT_BATCH_SIZE must be between 1 and the queue size %d, got %d", c.SpanQueueSize, c.SpanBatchSize)
+	}
+	if c.SpanScheduleDelay <= 0 {
+		return fmt.Errorf("OTEL_BSP_SCHEDULE_DELAY must be positive, got %s", c.SpanScheduleDelay)
+	}
+	if err := c.Sampling.validate(); err != nil {
+		return err
+	}
+	if _, ok := logTimeEncoders[c.Logging.TimeFormat]; !ok {
+		return fmt.Errorf("LOG_TIME_FORMAT %q: unsupported format", c.Logging.TimeFormat)
+	}
+	if err := newLoggerLevels(c.Logging.Level).parse(c.Logging.Levels); err != nil {
+		return fmt.Errorf("LOG_LEVELS: %w", err)
+	}
+	if !(c.SimulatedErrorRate >= 0 && c.SimulatedErrorRate <= 1) {
+		return fmt.Errorf("SIMULATED_ERROR_RATE must be in [0,1], got %v", c.SimulatedErrorRate)
+	}
+	if !(c.CacheHitRatio >= 0 && c.CacheHitRatio <= 1) {
+		return fmt.Errorf("CACHE_DEMO_HIT_RATIO must be in [0,1], got %v", c.CacheHitRatio)
+	}
+	if c.BodyCapture.MaxBytes < 0 {
+		return fmt.Errorf("BODY_CAPTURE_MAX_BYTES must not be negative, got %d", c.BodyCapture.MaxBytes)
+	}
+	if c.Tenant.MaxProviders < 1 {
+		return fmt.Errorf("TENANT_MAX_PROVIDERS must be positive, got %d", c.Tenant.MaxProviders)
+	}
+	if c.Tenant.IdleTimeout <= 0 {
+		return fmt.Errorf("TENANT_IDLE_TIMEOUT must be positive, got %s", c.Tenant.IdleTimeout)
+	}
+	if c.Readiness.Timeout <= 0 {
+		return fmt.Errorf("READINESS_TIMEOUT must be positive, got %s", c.Readiness.Timeout)
+	}
+	if err := c.LoadGen.validate(); err != nil {
+		return err
+	}
+	if c.HeapProfile.MaxSaved < 1 {
+		return fmt.Errorf("HEAP_PROFILE_MAX_SAVED must be positive, got %d", c.HeapProfile.MaxSaved)
+	}
+	if u, err := url.Parse(c.PyroscopeAddr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("PYROSCOPE_SERVER_ADDRESS %q: want an http or https URL", c.PyroscopeAddr)
+	}
+	return nil
+}
+
+func (g LoadGenConfig) validate() error {
+	if !(g.TracesPerSecond > 0 && g.TracesPerSecond <= maxLoadGenTracesPerSecond) {
+		return fmt.Errorf("LOADGEN_TRACES_PER_SECOND must be in (0,%g], got %v", maxLoadGenTracesPerSecond, g.TracesPerSecond)
+	}
+	if g.SpansPerTrace < 1 {
+		return fmt.Errorf("LOADGEN_SPANS_PER_TRACE must be positive, got %d", g.SpansPerTrace)
+	}
+	if g.Depth < 1 {
+		return fmt.Errorf("LOADGEN_DEPTH must be positive, got %d", g.Depth)
+	}
+	if g.AttributeSize < 0 {
+		return fmt.Errorf("LOADGEN_ATTRIBUTE_SIZE must not be negative, got %d", g.AttributeSize)
+	}
+	return nil
+}
+
+func (s SamplingConfig) validate() error {
+	if _, err := parseTraceSampler(s.Sampler, s.SamplerArg); err != nil {
+		return fmt.Errorf("OTEL_TRACES_SAMPLER: %w", err)
+	}
+	if s.Sampler != "" && (s.Adaptive || s.Consistent) {
+		return errors.New("OTEL_TRACES_SAMPLER cannot be combined with ADAPTIVE_SAMPLING_ENABLED or CONSISTENT_SAMPLING_RATIO")
+	}
+	if s.Adaptive && s.Consistent {
+		return errors.New("CONSISTENT_SAMPLING_RATIO and ADAPTIVE_SAMPLING_ENABLED are mutually exclusive")
+	}
+	if s.ForcePerSecond < 0 {
+		return fmt.Errorf("FORCE_SAMPLE_PER_SECOND must not be negative, got %v", s.ForcePerSecond)
+	}
+	return nil
+}
+
+// validateHostPort checks that addr is host:port with a valid port number.
+// The host may be empty, as in ":8080".
+func validateHostPort(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
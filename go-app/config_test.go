@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigRejectsInvalidValues(t *testing.T) {
+	for name, value := range map[string]string{
+		"SIMULATED_ERROR_RATE":         "abc",
+		"SPAN_ATTRIBUTE_MAX_LENGTH":    "long",
+		"HIGH_FREQUENCY_INTERVAL":      "1",
+		"OTEL_BSP_SCHEDULE_DELAY":      "5s",
+		"TENANT_ENABLED":               "maybe",
+		"LOADGEN_DEPTH":                "deep",
+		"LOADGEN_TRACES_PER_SECOND":    "2e9",
+		"LOG_TIME_FORMAT":              "sundial",
+		"HTTP_SPAN_NAME_FORMAT":        "verbose",
+		"HEAP_PROFILE_MAX_SAVED":       "0",
+		"OTEL_METRICS_EXEMPLAR_FILTER": "Always_On",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatalf("LoadConfig with %s=%q succeeded, want an error", name, value)
+			}
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("error %q does not name %s", err, name)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SimulatedErrorRate != 0 || cfg.LoadGen.Depth != 3 || cfg.Tenant.Header != "X-Tenant-ID" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
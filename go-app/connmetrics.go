@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// connTracker follows every connection through http.Server's ConnState
+// callback. http.server.connections holds the number of connections currently
+// in each state (new, active, idle); http.server.connections.closed.total
+// counts connections that went away, which together with new connections
+// shows keep-alive churn.
+type connTracker struct {
+	connections metric.Int64UpDownCounter
+	closed      metric.Int64Counter
+
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+}
+
+func newConnTracker(meter metric.Meter) (*connTracker, error) {
+	connections, err := meter.Int64UpDownCounter(
+		"http.server.connections",
+		metric.WithDescription("Number of HTTP server connections by state"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := meter.Int64Counter(
+		"http.server.connections.closed.total",
+		metric.WithDescription("Number of HTTP server connections closed or hijacked"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &connTracker{
+		connections: connections,
+		closed:      closed,
+		states:      make(map[net.Conn]http.ConnState),
+	}, nil
+}
+
+// ConnState is meant to be installed as http.Server.ConnState.
+func (t *connTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	prev, known := t.states[c]
+	if state == http.StateClosed || state == http.StateHijacked {
+		delete(t.states, c)
+	} else {
+		t.states[c] = state
+	}
+	t.mu.Unlock()
+
+	ctx := context.Background()
+	if known {
+		t.connections.Add(ctx, -1, metric.WithAttributes(connStateAttr(prev)))
+	}
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		t.closed.Add(ctx, 1, metric.WithAttributes(connStateAttr(state)))
+	default:
+		t.connections.Add(ctx, 1, metric.WithAttributes(connStateAttr(state)))
+	}
+}
+
+func connStateAttr(state http.ConnState) attribute.KeyValue {
+	return attribute.String("state", state.String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otTracestateKey is the tracestate vendor key OpenTelemetry uses for the
+// consistent sampling p-value and r-value.
+const otTracestateKey = "ot"
+
+// maxPValue means "never sample"; valid r-values are 0 through 62.
+const (
+	maxPValue = 63
+	maxRValue = 62
+)
+
+// consistentSampler implements consistent probability sampling: every trace
+// carries an r-value, a random number with P(r >= k) = 2^-k, and a span is
+// sampled when the sampler's p-value (-log2 of its probability) is <= r.
+// Because r travels in tracestate ("ot=r:N") and otherwise is derived from the
+// trace ID, every service configured with the same ratio reaches the same
+// decision for a trace, so traces are never partially sampled across hops.
+// A TraceIDRatioBased sampler only gives that guarantee when every service
+// uses the same SDK's trace ID arithmetic.
+//
+// Ratios that are not a power of two are approximated by picking between the
+// two neighbouring p-values, again from the trace ID so the choice is the same
+// everywhere.
+type consistentSampler struct {
+	ratio  float64
+	pFloor int     // p-value of the power of two just above ratio
+	pCeil  int     // p-value of the power of two just below ratio
+	pick   float64 // probability of using pFloor
+}
+
+var _ sdktrace.Sampler = (*consistentSampler)(nil)
+
+func newConsistentSampler(ratio float64) (*consistentSampler, error) {
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("consistent sampling ratio must be in [0,1], got %v", ratio)
+	}
+	s := &consistentSampler{ratio: ratio, pFloor: maxPValue, pCeil: maxPValue}
+	if ratio < math.Pow(2, -maxRValue) {
+		return s, nil
+	}
+
+	s.pFloor = int(math.Floor(-math.Log2(ratio)))
+	s.pCeil = s.pFloor + 1
+	if s.pCeil > maxRValue {
+		s.pCeil = maxPValue
+	}
+	high := math.Pow(2, -float64(s.pFloor))
+	low := 0.0
+	if s.pCeil != maxPValue {
+		low = math.Pow(2, -float64(s.pCeil))
+	}
+	if high == low {
+		s.pick = 1
+	} else {
+		s.pick = (ratio - low) / (high - low)
+	}
+	return s, nil
+}
+
+func (s *consistentSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	ts := trace.SpanContextFromContext(p.ParentContext).TraceState()
+
+	r, ok := parseOTRValue(ts.Get(otTracestateKey))
+	if !ok {
+		r = rValueFromTraceID(p.TraceID)
+	}
+
+	pValue := s.pCeil
+	if pickFraction(p.TraceID) < s.pick {
+		pValue = s.pFloor
+	}
+
+	decision := sdktrace.Drop
+	value := "r:" + strconv.Itoa(r)
+	if pValue <= r {
+		decision = sdktrace.RecordAndSample
+		value = "p:" + strconv.Itoa(pValue) + ";" + value
+	}
+	if updated, err := ts.Insert(otTracestateKey, value); err == nil {
+		ts = updated
+	}
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: ts}
+}
+
+func (s *consistentSampler) Description() string {
+	return fmt.Sprintf("ConsistentProbabilityBased{%g}", s.ratio)
+}
+
+// parseOTRValue extracts r from an "ot" tracestate value like "p:2;r:5".
+func parseOTRValue(v string) (int, bool) {
+	for _, field := range strings.Split(v, ";") {
+		if rv, ok := strings.CutPrefix(field, "r:"); ok {
+			r, err := strconv.Atoi(rv)
+			if err != nil || r < 0 || r > maxRValue {
+				return 0, false
+			}
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// rValueFromTraceID derives an r-value from the random low half of the trace
+// ID: the number of leading zero bits is geometrically distributed.
+func rValueFromTraceID(id trace.TraceID) int {
+	r := bits.LeadingZeros64(binary.BigEndian.Uint64(id[8:16]))
+	if r > maxRValue {
+		r = maxRValue
+	}
+	return r
+}
+
+// pickFraction maps the high half of the trace ID to [0,1).
+func pickFraction(id trace.TraceID) float64 {
+	return float64(binary.BigEndian.Uint64(id[0:8])>>11) / (1 << 53)
+}
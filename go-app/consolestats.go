@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// consoleStats keeps a few request counters in process and periodically logs
+// them, so developers get feedback without a collector or Grafana. It is
+// independent of the OTel exporters.
+type consoleStats struct {
+	total    atomic.Int64
+	errors   atomic.Int64
+	inFlight atomic.Int64
+}
+
+// Wrap counts every request served by next. Requests whose outcome is not
+// success count as errors.
+func (s *consoleStats) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		rw := newResponseRecorder(w)
+		next.ServeHTTP(rw, r)
+
+		s.total.Add(1)
+		if requestOutcome(r.Context(), rw) != outcomeSuccess {
+			s.errors.Add(1)
+		}
+	})
+}
+
+// run logs a snapshot every interval until done is closed. The error rate
+// covers only requests finished since the previous snapshot.
+func (s *consoleStats) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastTotal, lastErrors int64
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		total, errors := s.total.Load(), s.errors.Load()
+		var errorRate float64
+		if n := total - lastTotal; n > 0 {
+			errorRate = float64(errors-lastErrors) / float64(n)
+		}
+		lastTotal, lastErrors = total, errors
+
+		zap.L().Named(loggerBackground).Info("metrics snapshot",
+			zap.Int64("requests_total", total),
+			zap.Float64("error_rate", errorRate),
+			zap.Int64("in_flight", s.inFlight.Load()),
+		)
+	}
+}
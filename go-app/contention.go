@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// contentionHold is how long each goroutine holds the shared lock. It is
+// long enough that the others pile up waiting for it.
+const contentionHold = time.Millisecond
+
+// handleContention makes ?goroutines=N (default 8) goroutines fight over one
+// mutex for ?duration_ms=N (default 2000), each holding it for
+// contentionHold at a time, so the mutex and block profiles main enables
+// have something to show. The goroutines carry the request's pprof labels,
+// and the span records how long they spent waiting in total.
+func handleContention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := serverSpan(ctx, "contention")
+
+	query := r.URL.Query()
+	goroutines := 8
+	if v := query.Get("goroutines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 || n > 256 {
+			writeError(w, span, errValidation, http.StatusBadRequest, "goroutines must be an integer from 2 to 256")
+			return
+		}
+		goroutines = n
+	}
+	duration := 2 * time.Second
+	if v := query.Get("duration_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 || ms > 10000 {
+			writeError(w, span, errValidation, http.StatusBadRequest, "duration_ms must be an integer from 1 to 10000")
+			return
+		}
+		duration = time.Duration(ms) * time.Millisecond
+	}
+
+	// Bounded by duration, or less if the client disconnects
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		waited       atomic.Int64
+		acquisitions atomic.Int64
+	)
+	start := time.Now()
+	labels := requestProfileLabels(span.SpanContext().TraceID().String())
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go pprof.Do(ctx, labels, func(ctx context.Context) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				t := time.Now()
+				mu.Lock()
+				waited.Add(int64(time.Since(t)))
+				acquisitions.Add(1)
+				time.Sleep(contentionHold)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	span.SetAttributes(
+		attribute.Int("contention.goroutines", goroutines),
+		attribute.Int64("contention.acquisitions", acquisitions.Load()),
+		attribute.Float64("contention.duration_ms", float64(elapsed)/float64(time.Millisecond)),
+		attribute.Float64("contention.wait_ms", float64(waited.Load())/float64(time.Millisecond)),
+	)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"goroutines":   goroutines,
+		"acquisitions": acquisitions.Load(),
+		"duration_ms":  elapsed.Milliseconds(),
+		"wait_ms":      time.Duration(waited.Load()).Milliseconds(),
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultRequestTimeoutHeader carries the time an upstream still allows for
+// a request, and is forwarded on downstream calls with the time then left,
+// unless REQUEST_TIMEOUT_HEADER names another.
+const defaultRequestTimeoutHeader = "X-Request-Timeout-Ms"
+
+// grpcTimeoutHeader is gRPC's deadline header. Its values carry a unit
+// suffix, e.g. "250m" for 250 milliseconds; any other header name is read as
+// a plain number of milliseconds, as X-Request-Timeout-Ms is.
+const grpcTimeoutHeader = "grpc-timeout"
+
+// grpcTimeoutUnits maps grpc-timeout unit suffixes to durations.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// grpcTimeoutMaxDigits is the longest grpc-timeout value gRPC allows.
+const grpcTimeoutMaxDigits = 8
+
+// parseDeadlineHeader parses the remaining time an upstream allows for a
+// request from the value of the header called name. Values too large for a
+// time.Duration are rejected rather than wrapped around.
+func parseDeadlineHeader(name, value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(name, grpcTimeoutHeader) {
+		if len(value) < 2 || len(value) > grpcTimeoutMaxDigits+1 {
+			return 0, false
+		}
+		unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+		if !ok {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+			return 0, false
+		}
+		return time.Duration(n) * unit, true
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 || ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// formatDeadlineHeader formats d, rounded up to the millisecond, as a value
+// of the header called name.
+func formatDeadlineHeader(name string, d time.Duration) string {
+	if !strings.EqualFold(name, grpcTimeoutHeader) {
+		return strconv.FormatInt(int64((d+time.Millisecond-1)/time.Millisecond), 10)
+	}
+	// The first unit short enough to fit in grpc-timeout's digits
+	for _, unit := range []byte{'m', 'S', 'M', 'H'} {
+		length := grpcTimeoutUnits[unit]
+		if n := int64((d + length - 1) / length); n < 1e8 {
+			return strconv.FormatInt(n, 10) + string(unit)
+		}
+	}
+	return "99999999H"
+}
+
+// withRequestDeadline honors the deadline an upstream sends in header by
+// bounding the request context with it, so the handlers stop working once
+// the caller has given up. Missing or invalid values leave the request
+// unbounded; a deadline already on the context is never extended.
+func withRequestDeadline(header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := parseDeadlineHeader(header, r.Header.Get(header)); ok {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// budgetPhase is one sequential phase of a request, with its share of the
+// request's deadline relative to the other phases.
+type budgetPhase struct {
+	name   string
+	weight float64
+}
+
+// phaseOutcome is how a phase of a deadlineBudget ended.
+type phaseOutcome struct {
+	Phase    string  `json:"phase"`
+	BudgetMS float64 `json:"budget_ms"`
+	TookMS   float64 `json:"took_ms"`
+	Exceeded bool    `json:"deadline_exceeded"`
+}
+
+// deadlineBudget divides the time left until a request's deadline across
+// its phases in proportion to their weights, and enforces each share as a
+// sub-deadline. Shares are worked out as each phase starts, from the time
+// then left, so a phase finishing early hands its slack to the ones after
+// it, and one overrunning leaves them less.
+type deadlineBudget struct {
+	phases   []budgetPhase
+	exceeded metric.Int64Counter
+}
+
+func newDeadlineBudget(meter metric.Meter, phases ...budgetPhase) (*deadlineBudget, error) {
+	exceeded, err := meter.Int64Counter(
+		"request.phase.deadline_exceeded.total",
+		metric.WithDescription("Number of request phases that ran out of their share of the request deadline"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &deadlineBudget{phases: phases, exceeded: exceeded}, nil
+}
+
+// run runs fn once per phase, in order, each in its own span and under its
+// sub-deadline, which fn must honor. ctx must have a deadline. A phase
+// still running at its sub-deadline is recorded as deadline exceeded on its
+// span and in the counter, and the next phase starts.
+func (b *deadlineBudget) run(ctx context.Context, tracer trace.Tracer, fn func(ctx context.Context, phase string)) []phaseOutcome {
+	deadline, _ := ctx.Deadline()
+	var remaining float64
+	for _, p := range b.phases {
+		remaining += p.weight
+	}
+
+	outcomes := make([]phaseOutcome, 0, len(b.phases))
+	for _, p := range b.phases {
+		budget := time.Duration(float64(time.Until(deadline)) * p.weight / remaining)
+		remaining -= p.weight
+
+		phaseCtx, span := startSpan(ctx, tracer, "phase."+p.name, trace.WithAttributes(
+			attribute.String("phase.name", p.name),
+			attribute.Float64("phase.budget_ms", float64(budget)/float64(time.Millisecond)),
+		))
+		phaseCtx, cancel := context.WithTimeout(phaseCtx, budget)
+		start := time.Now()
+		fn(phaseCtx, p.name)
+		took := time.Since(start)
+		exceeded := errors.Is(phaseCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		span.SetAttributes(attribute.Bool("phase.deadline_exceeded", exceeded))
+		if exceeded {
+			span.SetStatus(codes.Error, "phase deadline exceeded")
+			b.exceeded.Add(phaseCtx, 1, metric.WithAttributes(attribute.String("phase", p.name)))
+		}
+		span.End()
+
+		outcomes = append(outcomes, phaseOutcome{
+			Phase:    p.name,
+			BudgetMS: float64(budget) / float64(time.Millisecond),
+			TookMS:   float64(took) / float64(time.Millisecond),
+			Exceeded: exceeded,
+		})
+	}
+	return outcomes
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseDeadlineHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+		want        time.Duration
+		ok          bool
+	}{
+		{"X-Request-Timeout-Ms", "250", 250 * time.Millisecond, true},
+		{"X-Request-Timeout-Ms", "0", 0, false},
+		{"X-Request-Timeout-Ms", "9223372036854775807", 0, false},
+		{"grpc-timeout", "250m", 250 * time.Millisecond, true},
+		{"grpc-timeout", "2S", 2 * time.Second, true},
+		{"grpc-timeout", "99999999H", 0, false},
+		{"grpc-timeout", "123456789m", 0, false},
+		{"grpc-timeout", "5x", 0, false},
+	} {
+		got, ok := parseDeadlineHeader(tc.name, tc.value)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseDeadlineHeader(%q, %q) = %v, %v, want %v, %v", tc.name, tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestFormatDeadlineHeaderRoundTrips(t *testing.T) {
+	for _, name := range []string{"X-Request-Timeout-Ms", "grpc-timeout"} {
+		for _, d := range []time.Duration{time.Microsecond, 250 * time.Millisecond, 30 * time.Hour} {
+			got, ok := parseDeadlineHeader(name, formatDeadlineHeader(name, d))
+			if !ok || got < d {
+				t.Errorf("%s: %v formatted as %q parses back to %v, %v", name, d, formatDeadlineHeader(name, d), got, ok)
+			}
+		}
+	}
+}
+
+func TestCallDownstreamForwardsDeadline(t *testing.T) {
+	var got string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(defaultRequestTimeoutHeader)
+	}))
+	t.Cleanup(downstream.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := callDownstream(ctx, downstream.URL, defaultRequestTimeoutHeader); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := parseDeadlineHeader(defaultRequestTimeoutHeader, got)
+	if !ok || d > 5*time.Second || d < 4*time.Second {
+		t.Errorf("%s = %q, want about 5s", defaultRequestTimeoutHeader, got)
+	}
+}
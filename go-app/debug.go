@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// registerDebugHandlers mounts the developer-only /debug endpoints. They are
+// only registered when DEBUG_ENDPOINTS is enabled, since they expose internal
+// state and can be expensive to compute.
+func registerDebugHandlers(routes *router, rec *spanRecorder, metrics *sdkmetric.ManualReader, headers []string) {
+	routes.HandleFunc("/debug/spanstats", handleSpanStats(rec))
+	routes.HandleFunc("/debug/pprof-labels", handlePprofLabels)
+	routes.HandleFunc("/debug/metrics/snapshot", handleMetricsSnapshot(metrics))
+	routes.HandleFunc("/debug/headers", handlePropagationHeaders(headers))
+	routes.HandleFunc("/debug/loglevel", handleLogLevel(namedLoggers))
+	routes.HandleFunc("/debug/contention", handleContention)
+}
+
+// parseHeaderNames parses a comma-separated list of header names.
+func parseHeaderNames(v string) []string {
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
+
+// handlePropagationHeaders reports the propagation headers of the request,
+// those of the global propagator plus the custom headers, the trace context
+// the app extracted from them, and the headers it would inject into an
+// outbound call made while handling the request. Missing headers are
+// reported as empty, so a hop that drops one stands out.
+func handlePropagationHeaders(custom []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		serverSpan(ctx, "propagationHeaders")
+
+		// Extracted again, apart from the server span otelhttp continued
+		propagator := otel.GetTextMapPropagator()
+		extracted := propagator.Extract(context.Background(), propagation.HeaderCarrier(r.Header))
+		remote := trace.SpanContextFromContext(extracted)
+
+		inbound := map[string]string{}
+		for _, name := range append(propagator.Fields(), custom...) {
+			inbound[strings.ToLower(name)] = strings.Join(r.Header.Values(name), ",")
+		}
+
+		outbound := propagation.MapCarrier{}
+		propagator.Inject(ctx, outbound)
+
+		var baggageMembers map[string]string
+		if members := baggage.FromContext(extracted).Members(); len(members) > 0 {
+			baggageMembers = make(map[string]string, len(members))
+			for _, m := range members {
+				baggageMembers[m.Key()] = m.Value()
+			}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"inbound": inbound,
+			"extracted": map[string]any{
+				"valid":      remote.IsValid(),
+				"trace_id":   remote.TraceID().String(),
+				"span_id":    remote.SpanID().String(),
+				"sampled":    remote.IsSampled(),
+				"tracestate": remote.TraceState().String(),
+				"baggage":    baggageMembers,
+			},
+			"outbound": outbound,
+		})
+	}
+}
+
+// handleSpanStats reports count, p50, p95 and max duration per span name over
+// the spans currently held by the in-memory recorder.
+func handleSpanStats(rec *spanRecorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"spans": rec.Stats(),
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Warn("failed to encode response", zap.Error(err))
+	}
+}
+
+// handlePprofLabels applies the same pprof labels /hello would to this
+// request's goroutine and reports them, whether the goroutine profile actually
+// shows them while set, and whether they are gone again after being cleared.
+func handlePprofLabels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := serverSpan(ctx, "pprofLabels")
+
+	traceID := span.SpanContext().TraceID().String()
+	ctx = pprof.WithLabels(ctx, requestProfileLabels(traceID))
+
+	labels := map[string]string{}
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		labels[key] = value
+		return true
+	})
+
+	pprof.SetGoroutineLabels(ctx)
+	applied, err := goroutineHasLabel("trace_id", traceID)
+	pprof.SetGoroutineLabels(context.Background())
+	if err != nil {
+		writeError(w, span, errInternal, http.StatusInternalServerError, err.Error())
+		return
+	}
+	stillSet, err := goroutineHasLabel("trace_id", traceID)
+	if err != nil {
+		writeError(w, span, errInternal, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"labels":  labels,
+		"applied": applied,
+		"cleared": !stillSet,
+	})
+}
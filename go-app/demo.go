@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// cancelDemoSteps are the sequential child operations of /cancel-demo.
+var cancelDemoSteps = []string{"fetch", "compute", "render"}
+
+// handleCancelDemo runs a few slow child operations that respect request
+// cancellation. Disconnect the client mid-request (e.g. Ctrl-C on curl) to
+// see the active step end as cancelled and the remaining steps skipped.
+// The per-step duration can be set with ?step_ms=N (default 1000).
+func handleCancelDemo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := tracerProvider(ctx).Tracer("go-sample-app")
+	span := serverSpan(ctx, "cancelDemo")
+
+	stepDuration := time.Second
+	if v := r.URL.Query().Get("step_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 || ms > 10000 {
+			writeError(w, span, errValidation, http.StatusBadRequest, "step_ms must be an integer from 1 to 10000")
+			return
+		}
+		stepDuration = time.Duration(ms) * time.Millisecond
+	}
+
+	for _, step := range cancelDemoSteps {
+		runCancellableStep(ctx, tracer, step, stepDuration)
+	}
+
+	if err := ctx.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "cancelled")
+		span.SetAttributes(capturedBodyAttrs(ctx)...)
+		zap.L().Named(loggerHTTP).Info("cancel demo aborted",
+			traceIDField(span.SpanContext()),
+			zap.Bool("trace_sampled", span.SpanContext().IsSampled()),
+			spanContextField(span.SpanContext()),
+			zap.Error(err),
+		)
+		// The client is gone, so there is nobody to write a response to.
+		return
+	}
+
+	span.SetStatus(codes.Ok, "")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("All steps completed\n"))
+}
+
+// runCancellableStep runs one child operation as its own span. If ctx is
+// already done the step is skipped; if it is cancelled while running the step
+// stops early. Either way the span records why.
+func runCancellableStep(ctx context.Context, tracer trace.Tracer, name string, d time.Duration) {
+	_, span := startSpan(ctx, tracer, "cancelDemo."+name)
+	defer span.End()
+
+	if err := ctx.Err(); err != nil {
+		span.SetAttributes(attribute.Bool("step.skipped", true))
+		span.SetStatus(codes.Error, "skipped: "+err.Error())
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		span.SetStatus(codes.Ok, "")
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		span.SetAttributes(attribute.Bool("step.cancelled", true))
+		span.SetStatus(codes.Error, "cancelled")
+	}
+}
+
+// Simulated latencies for /cache-demo.
+const (
+	cacheHitLatency  = 2 * time.Millisecond
+	cacheMissLatency = 80 * time.Millisecond
+)
+
+// cacheDemo simulates reads through a cache that hits with probability
+// hitRatio. Misses fall through to a slower simulated backend.
+type cacheDemo struct {
+	hitRatio float64
+	peers    map[string]string
+	hits     metric.Int64Counter
+	misses   metric.Int64Counter
+}
+
+func newCacheDemo(hitRatio float64, peers map[string]string) (*cacheDemo, error) {
+	meter := appMeter("go-sample-app/cache")
+	hits, err := meter.Int64Counter(
+		"cache.hits.total",
+		metric.WithDescription("Number of simulated cache lookups that hit"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	misses, err := meter.Int64Counter(
+		"cache.misses.total",
+		metric.WithDescription("Number of simulated cache lookups that missed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheDemo{hitRatio: hitRatio, peers: peers, hits: hits, misses: misses}, nil
+}
+
+// ServeHTTP looks up a simulated key. The hit ratio can be overridden per
+// request with ?hit_ratio=F (0 to 1).
+func (c *cacheDemo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := tracerProvider(ctx).Tracer("go-sample-app")
+	span := serverSpan(ctx, "cacheDemo")
+
+	hitRatio := c.hitRatio
+	if v := r.URL.Query().Get("hit_ratio"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			writeError(w, span, errValidation, http.StatusBadRequest, "hit_ratio must be a number from 0 to 1")
+			return
+		}
+		hitRatio = f
+	}
+
+	hit := rand.Float64() < hitRatio
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+
+	_, lookup := startSpan(ctx, tracer, "cache.get",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(peerServiceAttrs(c.peers, "cache.get")...),
+	)
+	time.Sleep(cacheHitLatency)
+	lookup.SetAttributes(attribute.Bool("cache.hit", hit))
+	lookup.End()
+
+	if hit {
+		c.hits.Add(ctx, 1)
+	} else {
+		c.misses.Add(ctx, 1)
+		_, fetch := startSpan(ctx, tracer, "backend.fetch",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(peerServiceAttrs(c.peers, "backend.fetch")...),
+		)
+		time.Sleep(cacheMissLatency)
+		fetch.End()
+	}
+
+	span.SetStatus(codes.Ok, "")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if hit {
+		w.Write([]byte("Cache hit\n"))
+	} else {
+		w.Write([]byte("Cache miss\n"))
+	}
+}
+
+// exemplarDemo records one simulated latency per request into a histogram,
+// with the request's trace as the exemplar, for checking that exemplars
+// render in Grafana and link through to Tempo.
+type exemplarDemo struct {
+	latency metric.Float64Histogram
+}
+
+func newExemplarDemo() (*exemplarDemo, error) {
+	latency, err := appMeter("go-sample-app/demo").Float64Histogram(
+		"demo.exemplar.latency",
+		metric.WithDescription("Simulated latency of /demo/exemplars requests, each with its trace as exemplar"),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(5, 10, 25, 50, 100, 250, 500, 1000),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &exemplarDemo{latency: latency}, nil
+}
+
+// exemplarDemoQuery is the heatmap query that shows the demo's exemplars.
+const exemplarDemoQuery = `sum by (le) (rate(demo_exemplar_latency_milliseconds_bucket[$__rate_interval]))`
+
+// ServeHTTP sleeps for a latency drawn from a long-tailed distribution
+// (median 50ms, capped at 1s), records it, and describes where to find it.
+func (d *exemplarDemo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := serverSpan(ctx, "exemplarDemo")
+
+	latency := math.Min(50*math.Exp(rand.NormFloat64()), 1000)
+	time.Sleep(time.Duration(latency * float64(time.Millisecond)))
+
+	// The span in ctx becomes the exemplar, if it is sampled
+	d.latency.Record(ctx, latency)
+	span.SetAttributes(attribute.Float64("demo.latency_ms", latency))
+	span.SetStatus(codes.Ok, "")
+
+	sc := span.SpanContext()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"trace_id":   sc.TraceID().String(),
+		"sampled":    sc.IsSampled(),
+		"latency_ms": latency,
+		"metric":     "demo_exemplar_latency_milliseconds",
+		"verify": []string{
+			"Send a few dozen requests so the heatmap has data.",
+			"In Grafana Explore, pick the Mimir datasource and run: " + exemplarDemoQuery,
+			"Show it as a heatmap and turn on Exemplars in the query options.",
+			"Each dot is one request; hover one and follow the trace_id link to the trace in Tempo.",
+			"Only sampled requests (sampled=true here) carry an exemplar.",
+		},
+	})
+}
+
+// budgetDemoPhases are the phases of /demo/deadline-budget with their
+// relative shares of the request deadline.
+var budgetDemoPhases = []budgetPhase{
+	{name: "allocate", weight: 1},
+	{name: "compute", weight: 3},
+	{name: "write", weight: 1},
+}
+
+// defaultBudgetDemoWork is how long each /demo/deadline-budget phase works
+// for unless overridden with ?<phase>_ms=N.
+const defaultBudgetDemoWork = 100 * time.Millisecond
+
+// budgetDemo runs the phases of a request under a deadline budget, for
+// traces showing which phase overran its share.
+type budgetDemo struct {
+	budget *deadlineBudget
+}
+
+func newBudgetDemo() (*budgetDemo, error) {
+	budget, err := newDeadlineBudget(appMeter("go-sample-app/demo"), budgetDemoPhases...)
+	if err != nil {
+		return nil, err
+	}
+	return &budgetDemo{budget: budget}, nil
+}
+
+// ServeHTTP works for ?<phase>_ms=N (default 100) in each phase, within a
+// share of the request deadline: the one set by the deadline header, or else
+// ?budget_ms=N (default 1000). It fails with ERR_TIMEOUT if any phase ran
+// out of its share.
+func (d *budgetDemo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tracer := tracerProvider(ctx).Tracer("go-sample-app")
+	span := serverSpan(ctx, "deadlineBudgetDemo")
+
+	query := r.URL.Query()
+	work := make(map[string]time.Duration, len(budgetDemoPhases))
+	for _, p := range budgetDemoPhases {
+		work[p.name] = defaultBudgetDemoWork
+		if v := query.Get(p.name + "_ms"); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil || ms < 0 || ms > 10000 {
+				writeError(w, span, errValidation, http.StatusBadRequest, p.name+"_ms must be an integer from 0 to 10000")
+				return
+			}
+			work[p.name] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		budget := time.Second
+		if v := query.Get("budget_ms"); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil || ms <= 0 || ms > 10000 {
+				writeError(w, span, errValidation, http.StatusBadRequest, "budget_ms must be an integer from 1 to 10000")
+				return
+			}
+			budget = time.Duration(ms) * time.Millisecond
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	outcomes := d.budget.run(ctx, tracer, func(ctx context.Context, phase string) {
+		timer := time.NewTimer(work[phase])
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	})
+
+	for _, o := range outcomes {
+		if o.Exceeded {
+			writeError(w, span, errTimeout, http.StatusGatewayTimeout, "phase "+o.Phase+" exceeded its deadline budget")
+			return
+		}
+	}
+	span.SetStatus(codes.Ok, "")
+	writeJSON(w, http.StatusOK, map[string]any{"phases": outcomes})
+}
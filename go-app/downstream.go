@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// downstreamClient starts a client span for each call and injects its
+// context into the outgoing headers. Like the /hello server span, the span
+// goes to the request's tenant, if any.
+var downstreamClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithTracerProvider(contextTracerProvider{})),
+}
+
+// parseDownstreamURL checks that v, the value of DOWNSTREAM_URL, is empty or
+// an absolute http or https URL.
+func parseDownstreamURL(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q: want an http or https URL", v)
+	}
+	return v, nil
+}
+
+// callDownstream GETs url as a child of the span in ctx, which it annotates
+// with the downstream status code, so Tempo's service graph shows the edge
+// between the services. Failed calls, including error statuses, are
+// recorded on the span and returned. The time left until the deadline of
+// ctx, if any, is sent in timeoutHeader.
+func callDownstream(ctx context.Context, url, timeoutHeader string) error {
+	span := trace.SpanFromContext(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	// Pass on what is left of the request deadline, so the downstream
+	// stops when this request can no longer use its answer
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, formatDeadlineHeader(timeoutHeader, time.Until(deadline)))
+	}
+	resp, err := downstreamClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("downstream call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	span.SetAttributes(attribute.Int("downstream.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		err := fmt.Errorf("downstream returned %s", resp.Status)
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestHelloFailsWithUpstreamError(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(downstream.Close)
+	cfg := Config{DownstreamURL: downstream.URL, RequestTimeoutHeader: defaultRequestTimeoutHeader}
+
+	metrics, err := newRequestMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	newServerHandler(newHelloHandler(cfg, metrics)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello?iterations=1&max_sleep_ms=0", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+	var body errorBody
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != errUpstream {
+		t.Errorf("error code = %q, want %q", body.Error.Code, errUpstream)
+	}
+}
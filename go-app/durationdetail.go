@@ -0,0 +1,42 @@
+package main
+
+import "strings"
+
+// Duration detail levels for ENDPOINT_DURATION_DETAIL.
+const (
+	// durationDetailFull records the http.request.duration histogram.
+	durationDetailFull = "full"
+	// durationDetailCount records only http.requests.total.
+	durationDetailCount = "count"
+)
+
+// durationDetail decides per endpoint whether request durations are recorded
+// in the histogram or only counted, trading fidelity for cardinality on
+// low-value endpoints. Endpoints are keyed by their unprefixed route pattern.
+type durationDetail map[string]bool
+
+// parseDurationDetail parses a comma-separated list of pattern=full|count
+// pairs. Entries with any other level are ignored.
+func parseDurationDetail(v string) durationDetail {
+	detail := durationDetail{}
+	for _, pair := range strings.Split(v, ",") {
+		pattern, level, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || pattern == "" {
+			continue
+		}
+		switch strings.TrimSpace(level) {
+		case durationDetailFull:
+			detail[pattern] = true
+		case durationDetailCount:
+			detail[pattern] = false
+		}
+	}
+	return detail
+}
+
+// RecordHistogram reports whether the endpoint registered as pattern records
+// the duration histogram. Endpoints not listed do.
+func (d durationDetail) RecordHistogram(pattern string) bool {
+	full, ok := d[pattern]
+	return !ok || full
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+// dynamicAttributes holds attributes that may change while the process runs,
+// such as deployment.color during a blue/green swap.
+//
+// They are deliberately not part of the resource: a resource describes the
+// entity producing telemetry and is immutable for the lifetime of a provider,
+// and backends assume it never changes for a given service instance. Values
+// that can flip at runtime are instead added to every span and to the request
+// metrics, so each data point carries the value that was current when it was
+// recorded.
+type dynamicAttributes struct {
+	attrs atomic.Pointer[[]attribute.KeyValue]
+}
+
+// requestDynamicAttrs are the dynamic attributes applied to /hello. Nil when
+// DYNAMIC_ATTRIBUTES_FILE is unset.
+var requestDynamicAttrs *dynamicAttributes
+
+func newDynamicAttributes() *dynamicAttributes {
+	d := &dynamicAttributes{}
+	d.Store(nil)
+	return d
+}
+
+// Attributes returns the current attributes. The slice must not be modified.
+func (d *dynamicAttributes) Attributes() []attribute.KeyValue {
+	if d == nil {
+		return nil
+	}
+	return *d.attrs.Load()
+}
+
+func (d *dynamicAttributes) Store(attrs []attribute.KeyValue) {
+	d.attrs.Store(&attrs)
+}
+
+// Load replaces the attributes with those in path, one key=value per line.
+// Blank lines and lines starting with # are ignored.
+func (d *dynamicAttributes) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	attrs, err := parseDynamicAttributes(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	d.Store(attrs)
+	return nil
+}
+
+func parseDynamicAttributes(s string) ([]attribute.KeyValue, error) {
+	var attrs []attribute.KeyValue
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key=value, got %q", i+1, line)
+		}
+		attrs = append(attrs, attribute.String(key, strings.TrimSpace(value)))
+	}
+	return attrs, nil
+}
+
+// reloadOnSIGHUP re-reads path whenever the process receives SIGHUP. A file
+// that fails to load is logged and the previous attributes are kept.
+func (d *dynamicAttributes) reloadOnSIGHUP(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := d.Load(path); err != nil {
+				zap.L().Named(loggerBackground).Error("failed to reload dynamic attributes", zap.Error(err))
+				continue
+			}
+			zap.L().Named(loggerBackground).Info("reloaded dynamic attributes",
+				zap.String("file", path),
+				zap.Int("count", len(d.Attributes())),
+			)
+		}
+	}()
+}
+
+// dynamicAttrProcessor stamps the current dynamic attributes on every span
+// when it starts.
+type dynamicAttrProcessor struct {
+	attrs *dynamicAttributes
+}
+
+var _ sdktrace.SpanProcessor = (*dynamicAttrProcessor)(nil)
+
+func (p *dynamicAttrProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(p.attrs.Attributes()...)
+}
+
+func (p *dynamicAttrProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (p *dynamicAttrProcessor) Shutdown(context.Context) error   { return nil }
+func (p *dynamicAttrProcessor) ForceFlush(context.Context) error { return nil }
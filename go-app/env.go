@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader reads typed settings from the environment. Unset or empty
+// variables give the default. A set but invalid value gives the default too,
+// so reading can go on, and is recorded in err: LoadConfig reports the first
+// one.
+type envReader struct {
+	err error
+}
+
+// lookup returns the value of name with surrounding spaces removed, and
+// whether it is set to anything.
+func (e *envReader) lookup(name string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(name))
+	return v, v != ""
+}
+
+func (e *envReader) invalid(name, kind, v string) {
+	if e.err == nil {
+		e.err = fmt.Errorf("%s: invalid %s %q", name, kind, v)
+	}
+}
+
+// String returns the value of name, or def when it is unset or empty.
+func (e *envReader) String(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// Bool parses name as a boolean.
+func (e *envReader) Bool(name string, def bool) bool {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.invalid(name, "boolean", v)
+		return def
+	}
+	return b
+}
+
+// Int parses name as an integer.
+func (e *envReader) Int(name string, def int) int {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.invalid(name, "integer", v)
+		return def
+	}
+	return n
+}
+
+// Float parses name as a float64.
+func (e *envReader) Float(name string, def float64) float64 {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.invalid(name, "number", v)
+		return def
+	}
+	return f
+}
+
+// Duration parses name as a time.Duration, such as "250ms".
+func (e *envReader) Duration(name string, def time.Duration) time.Duration {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.invalid(name, "duration", v)
+		return def
+	}
+	return d
+}
+
+// Millis parses name as a whole number of milliseconds, the unit of the
+// OTEL_* variables.
+func (e *envReader) Millis(name string, def time.Duration) time.Duration {
+	v, ok := e.lookup(name)
+	if !ok {
+		return def
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil {
+		e.invalid(name, "milliseconds", v)
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
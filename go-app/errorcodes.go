@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// errorCode identifies a class of application error. The same code is used
+// in the response body, as the span's error.type, as the errors metric label
+// and as the error.code log field, so one failure can be followed across
+// all of them.
+type errorCode string
+
+const (
+	errTimeout    errorCode = "ERR_TIMEOUT"    // the request deadline passed
+	errUpstream   errorCode = "ERR_UPSTREAM"   // a dependency failed
+	errValidation errorCode = "ERR_VALIDATION" // the request was malformed
+	errOverloaded errorCode = "ERR_OVERLOADED" // the server shed the request
+	errInternal   errorCode = "ERR_INTERNAL"   // anything else
+)
+
+// errorResponses counts responses written by writeError. Set in main by
+// registerErrorCounter.
+var errorResponses metric.Int64Counter = noop.Int64Counter{}
+
+func registerErrorCounter(meter metric.Meter) error {
+	counter, err := meter.Int64Counter(
+		"http.server.errors.total",
+		metric.WithDescription("Number of error responses, by application error code"),
+	)
+	if err != nil {
+		return err
+	}
+	errorResponses = counter
+	return nil
+}
+
+// errorBody is the JSON body of every error response.
+type errorBody struct {
+	Error struct {
+		Code    errorCode `json:"code"`
+		Message string    `json:"message"`
+	} `json:"error"`
+}
+
+// writeError fails the request with code: it marks span as failed, counts
+// and logs the error, and writes a JSON error response with status. span may
+// be the non-recording span of an untraced request.
+func writeError(w http.ResponseWriter, span trace.Span, code errorCode, status int, msg string) {
+	span.SetStatus(codes.Error, msg)
+	span.SetAttributes(attribute.String("error.type", string(code)))
+
+	// The span in the context links the count to the trace as an exemplar
+	ctx := trace.ContextWithSpan(context.Background(), span)
+	errorResponses.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("error.type", string(code)),
+		attribute.Int("http.response.status_code", status),
+	))
+
+	zap.L().Named(loggerHTTP).WithOptions(zap.AddCallerSkip(1)).Warn("request failed",
+		zap.String("error.code", string(code)),
+		zap.Int("status", status),
+		zap.String("message", msg),
+		traceIDField(span.SpanContext()),
+		spanContextField(span.SpanContext()),
+	)
+
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = msg
+	writeJSON(w, status, body)
+}
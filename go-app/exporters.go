@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+// Export resilience settings. A collector outage must never block request
+// handling or grow memory without bound: exports give up after
+// exportRetryMaxElapsed, the batch span processor drops spans rather than
+// blocking once its queue is full, and exporters reconnect on their own once
+// the collector is back.
+const (
+	exportTimeout          = 10 * time.Second
+	exportRetryInitial     = time.Second
+	exportRetryMaxInterval = 5 * time.Second
+	exportRetryMaxElapsed  = 30 * time.Second
+)
+
+// droppedSpansExporter counts the spans of every batch that could not be
+// exported after retries, i.e. spans lost during a collector outage. The
+// counter comes from the meter passed in, so it is reported with the metrics
+// of whichever pipeline owns the exporter.
+type droppedSpansExporter struct {
+	sdktrace.SpanExporter
+	dropped metric.Int64Counter
+}
+
+func newDroppedSpansExporter(exp sdktrace.SpanExporter, meter metric.Meter) (sdktrace.SpanExporter, error) {
+	dropped, err := meter.Int64Counter(
+		"otel.exporter.dropped_spans.total",
+		metric.WithDescription("Number of spans dropped because their export failed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &droppedSpansExporter{SpanExporter: exp, dropped: dropped}, nil
+}
+
+func (e *droppedSpansExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		e.dropped.Add(context.Background(), int64(len(spans)))
+	}
+	return err
+}
+
+// exportFailureTracker counts, per signal, how many exports in a row have
+// failed. Unlike a failure counter it tells a sustained outage from the
+// occasional failed export: alerting on it reaching N fires only once N
+// exports have failed back to back.
+//
+// Every otlpTarget has its own, so a tenant's failing backend doesn't show
+// up as failures of the main pipeline, or the other way round.
+type exportFailureTracker struct {
+	traces  atomic.Int64
+	metrics atomic.Int64
+	logs    atomic.Int64
+
+	// ready, if set, is set by the first successful export
+	ready *atomic.Bool
+}
+
+// record updates the streak of the signal counted by streak with the result
+// of an export.
+func (t *exportFailureTracker) record(streak *atomic.Int64, err error) {
+	if err != nil {
+		streak.Add(1)
+		return
+	}
+	streak.Store(0)
+	if t.ready != nil {
+		t.ready.Store(true)
+	}
+}
+
+// registerGauge reports otel.export.consecutive_failures per signal.
+func (t *exportFailureTracker) registerGauge(meter metric.Meter) error {
+	failures, err := meter.Int64ObservableGauge(
+		"otel.export.consecutive_failures",
+		metric.WithDescription("Number of exports in a row that failed, reset by a successful export"),
+	)
+	if err != nil {
+		return err
+	}
+	traces := metric.WithAttributes(attribute.String("signal", "traces"))
+	metrics := metric.WithAttributes(attribute.String("signal", "metrics"))
+	logs := metric.WithAttributes(attribute.String("signal", "logs"))
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(failures, t.traces.Load(), traces)
+		o.ObserveInt64(failures, t.metrics.Load(), metrics)
+		o.ObserveInt64(failures, t.logs.Load(), logs)
+		return nil
+	}, failures)
+	return err
+}
+
+// partialSuccessPattern matches the errors OTLP exporters report when the
+// backend accepted an export but rejected some of its items. The exporters'
+// error type is internal, so its message is the only thing to go on.
+var partialSuccessPattern = regexp.MustCompile(`^OTLP partial success: (.*) \((\d+) (spans|metric data points|log records) rejected\)$`)
+
+// parsePartialSuccess extracts the backend's message, the number of rejected
+// items and the signal from an OTLP partial success error.
+func parsePartialSuccess(err error) (msg string, rejected int64, signal string, ok bool) {
+	m := partialSuccessPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", 0, "", false
+	}
+	rejected, _ = strconv.ParseInt(m[2], 10, 64)
+	switch m[3] {
+	case "spans":
+		signal = "traces"
+	case "metric data points":
+		signal = "metrics"
+	case "log records":
+		signal = "logs"
+	}
+	return m[1], rejected, signal, true
+}
+
+// initErrorHandler routes errors reported by the OTel SDK, such as failed
+// exports, to the logger instead of the standard library log package.
+// Partial successes are also counted in otel.export.rejected_points.total,
+// since the backend silently drops the rejected items otherwise. Errors from
+// the OTLP log exporter go to stderr instead of the logger, which would
+// export them through the same exporter.
+func initErrorHandler(logger *zap.Logger) error {
+	rejectedPoints, err := appMeter("go-sample-app/exporter").Int64Counter(
+		"otel.export.rejected_points.total",
+		metric.WithDescription("Number of spans, metric data points and log records the backend rejected in partially successful exports"),
+	)
+	if err != nil {
+		return err
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		if msg, rejected, signal, ok := parsePartialSuccess(err); ok {
+			rejectedPoints.Add(context.Background(), rejected,
+				metric.WithAttributes(attribute.String("signal", signal)),
+			)
+			if errors.As(err, new(logExportError)) {
+				fmt.Fprintf(os.Stderr, "opentelemetry export partially rejected: %v\n", err)
+				return
+			}
+			logger.Warn("opentelemetry export partially rejected",
+				zap.String("signal", signal),
+				zap.Int64("rejected", rejected),
+				zap.String("message", msg),
+			)
+			return
+		}
+		if errors.As(err, new(logExportError)) {
+			fmt.Fprintf(os.Stderr, "opentelemetry error: %v\n", err)
+			return
+		}
+		logger.Warn("opentelemetry error", zap.Error(err))
+	}))
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Feature flags that change how a request is observed.
+const (
+	// flagExtraAttributes adds client details to the request span.
+	flagExtraAttributes = "extra_attributes"
+	// flagVerboseLogging logs request headers and workload progress.
+	flagVerboseLogging = "verbose_logging"
+	// flagForceSample samples the request's trace regardless of the sampler.
+	flagForceSample = "force_sample"
+	// flagAsyncWork hands off follow-up work to a background goroutine.
+	flagAsyncWork = "async_work"
+)
+
+var knownFeatureFlags = map[string]bool{
+	flagExtraAttributes: true,
+	flagVerboseLogging:  true,
+	flagForceSample:     true,
+	flagAsyncWork:       true,
+}
+
+// sensitiveHeaders are never logged verbatim, even with verbose logging on.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"Set-Cookie":          true,
+}
+
+// featureFlags is the set of flags active for a request.
+type featureFlags map[string]bool
+
+// parseFeatureFlags parses a comma-separated flag list, ignoring unknown flags
+// so a client can't grow the set arbitrarily.
+func parseFeatureFlags(v string) featureFlags {
+	flags := featureFlags{}
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); knownFeatureFlags[f] {
+			flags[f] = true
+		}
+	}
+	return flags
+}
+
+// Enabled reports whether flag is active.
+func (f featureFlags) Enabled(flag string) bool {
+	return f[flag]
+}
+
+// List returns the active flags in sorted order.
+func (f featureFlags) List() []string {
+	list := make([]string, 0, len(f))
+	for flag := range f {
+		list = append(list, flag)
+	}
+	sort.Strings(list)
+	return list
+}
+
+type featureFlagsContextKey struct{}
+
+// featureFlagsFromContext returns the flags stored by withFeatureFlags.
+func featureFlagsFromContext(ctx context.Context) featureFlags {
+	flags, _ := ctx.Value(featureFlagsContextKey{}).(featureFlags)
+	return flags
+}
+
+// withFeatureFlags stores the flags active for each request in its context:
+// the configured defaults plus any listed in header.
+func withFeatureFlags(defaults featureFlags, header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flags := featureFlags{}
+		for flag := range defaults {
+			flags[flag] = true
+		}
+		for flag := range parseFeatureFlags(r.Header.Get(header)) {
+			flags[flag] = true
+		}
+		if len(flags) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), featureFlagsContextKey{}, flags))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forceSampleSampler samples any span started from a context carrying the
+// force_sample flag and defers to next otherwise. Since any client can send
+// the flag, at most perSecond traces a second are forced; the rest, and all
+// of them with a zero rate, get next's decision. Spans within a forced trace
+// follow it without counting against the rate. Only forced roots that next
+// would have dropped count as sampling overrides.
+type forceSampleSampler struct {
+	next      sdktrace.Sampler
+	perSecond float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ sdktrace.Sampler = (*forceSampleSampler)(nil)
+
+func newForceSampleSampler(next sdktrace.Sampler, perSecond float64) sdktrace.Sampler {
+	return &forceSampleSampler{next: next, perSecond: perSecond, tokens: math.Max(perSecond, 1), last: time.Now()}
+}
+
+func (s *forceSampleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if !featureFlagsFromContext(p.ParentContext).Enabled(flagForceSample) {
+		return s.next.ShouldSample(p)
+	}
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	res := sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Tracestate: parent.TraceState(),
+	}
+	if parent.IsValid() && !parent.IsRemote() {
+		// Within the trace, only follow a forced decision
+		if !parent.IsSampled() {
+			return s.next.ShouldSample(p)
+		}
+		return res
+	}
+	if !s.allow() {
+		return s.next.ShouldSample(p)
+	}
+	if s.next.ShouldSample(p).Decision != res.Decision {
+		recordSamplingOverride(p, overrideForceSample, res)
+	}
+	return res
+}
+
+// allow takes a token from a bucket refilled at perSecond, holding at most
+// one second's worth, or one token for rates below one a second.
+func (s *forceSampleSampler) allow() bool {
+	if s.perSecond <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.tokens = math.Min(math.Max(s.perSecond, 1), s.tokens+now.Sub(s.last).Seconds()*s.perSecond)
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *forceSampleSampler) Description() string {
+	return "ForceSample{" + s.next.Description() + "}"
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func forceSampleParams() sdktrace.SamplingParameters {
+	ctx := context.WithValue(context.Background(), featureFlagsContextKey{}, featureFlags{flagForceSample: true})
+	return sdktrace.SamplingParameters{ParentContext: ctx, TraceID: trace.TraceID{1}, Name: "request"}
+}
+
+func TestForceSampleSamplerRateLimit(t *testing.T) {
+	s := newForceSampleSampler(sdktrace.NeverSample(), 2)
+	var sampled int
+	for i := 0; i < 10; i++ {
+		if s.ShouldSample(forceSampleParams()).Decision == sdktrace.RecordAndSample {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Errorf("forced %d of 10 traces, want 2", sampled)
+	}
+}
+
+func TestForceSampleSamplerDisabled(t *testing.T) {
+	s := newForceSampleSampler(sdktrace.NeverSample(), 0)
+	if d := s.ShouldSample(forceSampleParams()).Decision; d != sdktrace.Drop {
+		t.Errorf("Decision = %v with a zero rate, want Drop", d)
+	}
+}
+
+func TestForceSampleSamplerChildrenFollowForcedRoot(t *testing.T) {
+	s := newForceSampleSampler(sdktrace.NeverSample(), 1)
+	if d := s.ShouldSample(forceSampleParams()).Decision; d != sdktrace.RecordAndSample {
+		t.Fatalf("root Decision = %v, want RecordAndSample", d)
+	}
+
+	p := forceSampleParams()
+	p.ParentContext = trace.ContextWithSpanContext(p.ParentContext, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    p.TraceID,
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	// The bucket is empty, but children don't draw from it
+	for i := 0; i < 3; i++ {
+		if d := s.ShouldSample(p).Decision; d != sdktrace.RecordAndSample {
+			t.Errorf("child Decision = %v, want RecordAndSample", d)
+		}
+	}
+}
+
+func TestForceSampleSamplerCountsOnlyOverriddenRoots(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	prev := samplingOverrides
+	t.Cleanup(func() { samplingOverrides = prev })
+	if err := registerSamplingOverrideCounter(mp.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	// One forced trace of a root and three children
+	s := newForceSampleSampler(sdktrace.NeverSample(), 10)
+	s.ShouldSample(forceSampleParams())
+	child := forceSampleParams()
+	child.ParentContext = trace.ContextWithSpanContext(child.ParentContext, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    child.TraceID,
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	for i := 0; i < 3; i++ {
+		s.ShouldSample(child)
+	}
+	// A forced root next would have sampled anyway overrides nothing
+	newForceSampleSampler(sdktrace.AlwaysSample(), 10).ShouldSample(forceSampleParams())
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	if total != 1 {
+		t.Errorf("counted %d sampling overrides, want 1 for the forced root", total)
+	}
+}
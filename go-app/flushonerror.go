@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// flushOnErrorProcessor wraps the export processor. When a span ends with an
+// error status its trace is marked, and when the trace's local root span
+// ends the wrapped processor is flushed. Flushes run in the background and
+// are coalesced, so a burst of errors causes at most one queued flush.
+//
+// Traces are only tracked while a local root is running, so spans that end
+// after their root, or belong to no local root, leave nothing behind.
+type flushOnErrorProcessor struct {
+	sdktrace.SpanProcessor
+
+	mu     sync.Mutex
+	traces map[trace.TraceID]*errorTrace
+
+	trigger chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+}
+
+var _ sdktrace.SpanProcessor = (*flushOnErrorProcessor)(nil)
+
+func newFlushOnErrorProcessor(next sdktrace.SpanProcessor) *flushOnErrorProcessor {
+	p := &flushOnErrorProcessor{
+		SpanProcessor: next,
+		traces:        make(map[trace.TraceID]*errorTrace),
+		trigger:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *flushOnErrorProcessor) run() {
+	for {
+		select {
+		case <-p.trigger:
+			ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			if err := p.SpanProcessor.ForceFlush(ctx); err != nil {
+				zap.L().Named(loggerOTel).Warn("failed to flush error trace", zap.Error(err))
+			}
+			cancel()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// errorTrace is a trace with local root spans still running.
+type errorTrace struct {
+	roots   int // running local roots
+	errored bool
+}
+
+// isLocalRoot reports whether s is the root of its trace in this process.
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
+
+func (p *flushOnErrorProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.SpanProcessor.OnStart(ctx, s)
+	if !isLocalRoot(s) {
+		return
+	}
+
+	traceID := s.SpanContext().TraceID()
+	p.mu.Lock()
+	t, ok := p.traces[traceID]
+	if !ok {
+		t = &errorTrace{}
+		p.traces[traceID] = t
+	}
+	t.roots++
+	p.mu.Unlock()
+}
+
+func (p *flushOnErrorProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.SpanProcessor.OnEnd(s)
+
+	traceID := s.SpanContext().TraceID()
+	isRoot := isLocalRoot(s)
+
+	p.mu.Lock()
+	t, ok := p.traces[traceID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	if s.Status().Code == codes.Error {
+		t.errored = true
+	}
+	flush := isRoot && t.errored
+	if isRoot {
+		t.roots--
+		if t.roots == 0 {
+			delete(p.traces, traceID)
+		}
+	}
+	p.mu.Unlock()
+
+	if flush {
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *flushOnErrorProcessor) Shutdown(ctx context.Context) error {
+	p.stopped.Do(func() { close(p.done) })
+	return p.SpanProcessor.Shutdown(ctx)
+}
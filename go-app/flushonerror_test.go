@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFlushOnErrorForgetsEndedTraces(t *testing.T) {
+	p := newFlushOnErrorProcessor(tracetest.NewSpanRecorder())
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "request")
+	_, inTime := tracer.Start(ctx, "work")
+	inTime.SetStatus(codes.Error, "failed")
+	inTime.End()
+	// Outlives the request, as background work does
+	_, late := tracer.Start(ctx, "follow-up")
+	root.End()
+	late.SetStatus(codes.Error, "failed")
+	late.End()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.traces); n != 0 {
+		t.Errorf("%d traces still tracked after their root ended", n)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// requestHeapProfiles saves heap profiles around /hello requests that
+// allocate a lot, when set from HEAP_PROFILE_ALLOC_THRESHOLD.
+var requestHeapProfiles *heapProfiler
+
+// heapProfiler keeps heap profiles of requests that allocated at least
+// threshold bytes: one taken as the work ends and a base taken before the
+// request started. Comparing the two with pprof's -base flag shows where the
+// request's allocations came from. The profiles are process-wide, so
+// concurrent requests show up in the difference too.
+//
+// Serialising a heap profile is costly, so requests share a base profile
+// taken at most every heapBaseMaxAge, and only the latest maxSaved pairs are
+// kept on disk.
+type heapProfiler struct {
+	threshold uint64
+	dir       string
+	maxSaved  int
+
+	mu        sync.Mutex
+	base      []byte
+	baseTaken time.Time
+	saved     []string // paths of the saved pairs, oldest first
+}
+
+// heapBaseMaxAge is how long a base profile is shared between requests.
+// Allocation profiles are cumulative, so an older base only adds the
+// allocations made before the request to the difference.
+const heapBaseMaxAge = time.Second
+
+func newHeapProfiler(threshold uint64, dir string, maxSaved int) (*heapProfiler, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &heapProfiler{threshold: threshold, dir: dir, maxSaved: maxSaved}, nil
+}
+
+// heapCapture is the state of the heap as a request started.
+type heapCapture struct {
+	base   []byte
+	allocs uint64
+}
+
+// heapAllocs returns the bytes allocated on the heap since the process
+// started.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// start notes the allocations so far and picks the base profile, taking a
+// new one if the shared one is too old. Heap profiles are as of the last
+// GC, so the base also covers allocations made after that but before the
+// request.
+func (p *heapProfiler) start() (*heapCapture, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.baseTaken) >= heapBaseMaxAge {
+		var base bytes.Buffer
+		if err := pprof.Lookup("heap").WriteTo(&base, 0); err != nil {
+			return nil, err
+		}
+		p.base, p.baseTaken = base.Bytes(), time.Now()
+	}
+	return &heapCapture{base: p.base, allocs: heapAllocs()}, nil
+}
+
+// finish saves both profiles of c, named after the trace, if the request
+// allocated at least the threshold since start, and records where they are
+// on span. It forces a GC so the second profile includes the request's
+// allocations.
+func (p *heapProfiler) finish(c *heapCapture, span trace.Span, logger *zap.Logger) error {
+	allocated := heapAllocs() - c.allocs
+	span.SetAttributes(attribute.Int64("work.heap.allocated", int64(allocated)))
+	if allocated < p.threshold {
+		return nil
+	}
+
+	runtime.GC()
+	var profile bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&profile, 0); err != nil {
+		return err
+	}
+
+	name := span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String()
+	basePath := filepath.Join(p.dir, name+".base.pb.gz")
+	path := filepath.Join(p.dir, name+".pb.gz")
+	if err := os.WriteFile(basePath, c.base, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, profile.Bytes(), 0o644); err != nil {
+		return err
+	}
+	p.prune(path, basePath)
+
+	span.SetAttributes(
+		attribute.String("pprof.heap_profile", path),
+		attribute.String("pprof.heap_profile.base", basePath),
+	)
+	logger.Info("saved heap profiles of request",
+		zap.Uint64("allocated_bytes", allocated),
+		zap.String("profile", path),
+		zap.String("base_profile", basePath),
+		zap.String("inspect", fmt.Sprintf("go tool pprof -sample_index=alloc_space -base %s %s", basePath, path)),
+	)
+	return nil
+}
+
+// prune records a newly saved pair and deletes the oldest pairs beyond
+// maxSaved.
+func (p *heapProfiler) prune(paths ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saved = append(p.saved, paths...)
+	for len(p.saved) > 2*p.maxSaved {
+		if err := os.Remove(p.saved[0]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			zap.L().Warn("failed to delete old heap profile", zap.Error(err))
+		}
+		p.saved = p.saved[1:]
+	}
+}
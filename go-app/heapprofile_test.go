@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+)
+
+func TestHeapProfilerKeepsLatestPairs(t *testing.T) {
+	dir := t.TempDir()
+	p, err := newHeapProfiler(1, dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	var bases [][]byte
+	for i := 0; i < 3; i++ {
+		c, err := p.start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bases = append(bases, c.base)
+		_ = make([]byte, 1<<20)
+		_, span := tp.Tracer("test").Start(context.Background(), "request")
+		if err := p.finish(c, span, zap.NewNop()); err != nil {
+			t.Fatal(err)
+		}
+		span.End()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("%d files saved, want the latest 2 pairs", len(entries))
+	}
+	// Started well within heapBaseMaxAge of each other
+	if &bases[0][0] != &bases[2][0] {
+		t.Error("requests took their own base profile instead of sharing one")
+	}
+}
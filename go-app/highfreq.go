@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// parseMetricNames parses a comma-separated list of instrument names.
+func parseMetricNames(v string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// newHighFrequencyMeterProvider builds the meter provider the high-frequency
+// instruments are created on, exporting to target every interval.
+//
+// SDK views apply to every reader of a meter provider, so they can't limit a
+// faster reader to some instruments. A provider of its own can: the
+// instrument registry creates only the high-frequency instruments on it, and
+// only the others on the main provider, so its reader collects nothing else
+// and every metric is exported at exactly one rate.
+func newHighFrequencyMeterProvider(ctx context.Context, res *resource.Resource, target *otlpTarget, interval time.Duration, views ...sdkmetric.View) (*sdkmetric.MeterProvider, error) {
+	exp, err := newTargetMetricExporter(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(views...),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp,
+			sdkmetric.WithInterval(interval),
+		)),
+	), nil
+}
+
+// highFrequencyRoute sends the instruments named in names, created through
+// the registry's meters of main, to fast instead.
+type highFrequencyRoute struct {
+	main  metric.MeterProvider
+	fast  metric.MeterProvider
+	names map[string]bool
+
+	mu     sync.Mutex
+	insts  map[metric.Observable]bool // observable instruments created on fast
+	routed map[string]bool            // names of the instruments created on fast
+}
+
+// routeHighFrequency creates the instruments in names on fast rather than
+// main from now on. Instruments already created are left where they are.
+func (r *instrumentRegistry) routeHighFrequency(main, fast metric.MeterProvider, names map[string]bool) {
+	r.route.Store(&highFrequencyRoute{
+		main:   main,
+		fast:   fast,
+		names:  names,
+		insts:  make(map[metric.Observable]bool),
+		routed: make(map[string]bool),
+	})
+}
+
+// unroutedHighFrequency returns the sorted names routed to the fast provider
+// that no instrument has been created with there: instruments created before
+// routeHighFrequency, or names of no instrument at all.
+func (r *instrumentRegistry) unroutedHighFrequency() []string {
+	rt := r.route.Load()
+	if rt == nil {
+		return nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var names []string
+	for name := range rt.names {
+		if !rt.routed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// warnUnroutedHighFrequency warns about the HIGH_FREQUENCY_METRICS that are
+// not exported at the high frequency, once startup has created the
+// instruments.
+func warnUnroutedHighFrequency(logger *zap.Logger) {
+	if names := instruments.unroutedHighFrequency(); len(names) > 0 {
+		logger.Warn("HIGH_FREQUENCY_METRICS names no instrument created on the high-frequency provider",
+			zap.Strings("metrics", names),
+		)
+	}
+}
+
+func (rt *highFrequencyRoute) markRouted(name string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.routed[name] = true
+}
+
+func (rt *highFrequencyRoute) markFast(inst metric.Observable) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.insts[inst] = true
+}
+
+func (rt *highFrequencyRoute) isFast(inst metric.Observable) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.insts[inst]
+}
+
+// observableOn creates an observable instrument with create on the meter its
+// name is routed to, remembering those created on the fast one.
+func observableOn[T metric.Observable](m *checkedMeter, name string, create func(metric.Meter) (T, error)) (T, error) {
+	if m.fast == nil || !m.route.names[name] {
+		return create(m.Meter)
+	}
+	inst, err := create(m.fast)
+	if err == nil {
+		m.route.markFast(inst)
+		m.route.markRouted(name)
+	}
+	return inst, err
+}
+
+// RegisterCallback registers f for instruments that may be split across the
+// main and the fast meter. The SDK only lets a callback observe instruments
+// of the meter it is registered with, so f is registered with each, seeing
+// only that meter's instruments.
+func (m *checkedMeter) RegisterCallback(f metric.Callback, insts ...metric.Observable) (metric.Registration, error) {
+	if m.fast == nil {
+		return m.Meter.RegisterCallback(f, insts...)
+	}
+	var slow, fast []metric.Observable
+	for _, inst := range insts {
+		if m.route.isFast(inst) {
+			fast = append(fast, inst)
+		} else {
+			slow = append(slow, inst)
+		}
+	}
+	switch {
+	case len(fast) == 0:
+		return m.Meter.RegisterCallback(f, slow...)
+	case len(slow) == 0:
+		return m.fast.RegisterCallback(f, fast...)
+	}
+
+	slowReg, err := m.Meter.RegisterCallback(m.route.only(false, f), slow...)
+	if err != nil {
+		return nil, err
+	}
+	fastReg, err := m.fast.RegisterCallback(m.route.only(true, f), fast...)
+	if err != nil {
+		return nil, multierr.Append(err, slowReg.Unregister())
+	}
+	return registrations{regs: []metric.Registration{slowReg, fastReg}}, nil
+}
+
+// only wraps f so that it observes only the fast instruments, or only the
+// others.
+func (rt *highFrequencyRoute) only(fast bool, f metric.Callback) metric.Callback {
+	return func(ctx context.Context, o metric.Observer) error {
+		return f(ctx, filteredObserver{Observer: o, keep: func(inst metric.Observable) bool {
+			return rt.isFast(inst) == fast
+		}})
+	}
+}
+
+// filteredObserver drops observations of the instruments keep rejects.
+type filteredObserver struct {
+	metric.Observer
+	keep func(metric.Observable) bool
+}
+
+func (o filteredObserver) ObserveInt64(inst metric.Int64Observable, v int64, opts ...metric.ObserveOption) {
+	if o.keep(inst) {
+		o.Observer.ObserveInt64(inst, v, opts...)
+	}
+}
+
+func (o filteredObserver) ObserveFloat64(inst metric.Float64Observable, v float64, opts ...metric.ObserveOption) {
+	if o.keep(inst) {
+		o.Observer.ObserveFloat64(inst, v, opts...)
+	}
+}
+
+// registrations unregisters a callback registered with several meters.
+type registrations struct {
+	embedded.Registration
+	regs []metric.Registration
+}
+
+func (rs registrations) Unregister() error {
+	var err error
+	for _, r := range rs.regs {
+		err = multierr.Append(err, r.Unregister())
+	}
+	return err
+}
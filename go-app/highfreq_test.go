@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectedNames returns the names of the metrics reader collects.
+func collectedNames(t *testing.T, reader sdkmetric.Reader) map[string]bool {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	return names
+}
+
+func TestHighFrequencyInstrumentsUseTheirOwnProvider(t *testing.T) {
+	mainReader, fastReader := sdkmetric.NewManualReader(), sdkmetric.NewManualReader()
+	mainMP := sdkmetric.NewMeterProvider(sdkmetric.WithReader(mainReader))
+	fastMP := sdkmetric.NewMeterProvider(sdkmetric.WithReader(fastReader))
+	t.Cleanup(func() {
+		_ = mainMP.Shutdown(context.Background())
+		_ = fastMP.Shutdown(context.Background())
+	})
+	reg := newInstrumentRegistry()
+	reg.routeHighFrequency(mainMP, fastMP, map[string]bool{"test.in_flight": true, "test.queue.age": true})
+
+	ctx := context.Background()
+	meter := reg.Meter(mainMP, "test")
+	requests, err := meter.Int64Counter("test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight, err := meter.Int64UpDownCounter("test.in_flight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests.Add(ctx, 1)
+	inFlight.Add(ctx, 1)
+
+	// One callback observing an instrument on each provider
+	size, err := meter.Int64ObservableGauge("test.queue.size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	age, err := meter.Float64ObservableGauge("test.queue.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(size, 3)
+		o.ObserveFloat64(age, 12)
+		return nil
+	}, size, age)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mainNames, fastNames := collectedNames(t, mainReader), collectedNames(t, fastReader)
+	for name, fast := range map[string]bool{
+		"test.requests":   false,
+		"test.in_flight":  true,
+		"test.queue.size": false,
+		"test.queue.age":  true,
+	} {
+		if mainNames[name] == fast || fastNames[name] != fast {
+			t.Errorf("%s collected by main = %t, by fast = %t; want only by fast = %t", name, mainNames[name], fastNames[name], fast)
+		}
+	}
+}
+
+func TestUnroutedHighFrequencyReportsInstrumentsCreatedBeforeRoute(t *testing.T) {
+	mainMP, fastMP := sdkmetric.NewMeterProvider(), sdkmetric.NewMeterProvider()
+	reg := newInstrumentRegistry()
+	if _, err := reg.Meter(mainMP, "test").Int64Counter("test.early"); err != nil {
+		t.Fatal(err)
+	}
+	reg.routeHighFrequency(mainMP, fastMP, map[string]bool{"test.early": true, "test.late": true, "test.missing": true})
+	if _, err := reg.Meter(mainMP, "test").Int64Counter("test.late"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := reg.unroutedHighFrequency()
+	if want := []string{"test.early", "test.missing"}; !slices.Equal(got, want) {
+		t.Errorf("unroutedHighFrequency() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// idempotencyKeyHeader identifies logically identical requests; a client
+// retrying a request resends the same key.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds the memory a single key can take in the cache.
+const maxIdempotencyKeyLen = 255
+
+type seenKey struct {
+	key       string
+	firstSeen time.Time
+	attempts  int
+}
+
+// idempotencyCache remembers recently seen Idempotency-Key values so repeated
+// requests can be recognized as retries. Keys expire after window and the
+// cache holds at most maxKeys, evicting the oldest first.
+type idempotencyCache struct {
+	window  time.Duration
+	maxKeys int
+
+	mu    sync.Mutex
+	order *list.List // of *seenKey, oldest first
+	keys  map[string]*list.Element
+}
+
+func newIdempotencyCache(window time.Duration, maxKeys int) *idempotencyCache {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &idempotencyCache{
+		window:  window,
+		maxKeys: maxKeys,
+		order:   list.New(),
+		keys:    make(map[string]*list.Element),
+	}
+}
+
+// Observe records a request carrying key and returns which attempt it is,
+// starting at 1 for the first time the key is seen within the window.
+func (c *idempotencyCache) Observe(key string, now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expire keys that fell out of the window
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		sk := el.Value.(*seenKey)
+		if now.Sub(sk.firstSeen) <= c.window {
+			break
+		}
+		c.order.Remove(el)
+		delete(c.keys, sk.key)
+	}
+
+	if el, ok := c.keys[key]; ok {
+		sk := el.Value.(*seenKey)
+		sk.attempts++
+		return sk.attempts
+	}
+
+	if c.order.Len() >= c.maxKeys {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.keys, oldest.Value.(*seenKey).key)
+	}
+	c.keys[key] = c.order.PushBack(&seenKey{key: key, firstSeen: now, attempts: 1})
+	return 1
+}
+
+type requestAttemptContextKey struct{}
+
+// requestAttempt returns the attempt number recorded by withRetryDetection,
+// or 0 if the request carried no Idempotency-Key.
+func requestAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(requestAttemptContextKey{}).(int)
+	return attempt
+}
+
+// retryAttrs describes the request's attempt for span attributes.
+func retryAttrs(ctx context.Context) []attribute.KeyValue {
+	attempt := requestAttempt(ctx)
+	if attempt == 0 {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.Bool("http.request.retry", attempt > 1),
+		attribute.Int("http.request.attempt", attempt),
+	}
+}
+
+// withRetryDetection counts requests repeating a recently seen
+// Idempotency-Key in http.requests.retries.total and stores the attempt
+// number in the request context.
+func withRetryDetection(cache *idempotencyCache, retries metric.Int64Counter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key != "" && len(key) <= maxIdempotencyKeyLen {
+			attempt := cache.Observe(key, time.Now())
+			if attempt > 1 {
+				retries.Add(r.Context(), 1, metric.WithAttributes(
+					attribute.String("path", r.URL.Path),
+					attribute.String("method", r.Method),
+				))
+			}
+			r = r.WithContext(context.WithValue(r.Context(), requestAttemptContextKey{}, attempt))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parseIDGenerator returns the generator named by TRACE_ID_GENERATOR:
+// "random" (or empty) for the SDK default, or "seeded" for a deterministic
+// sequence from seed.
+func parseIDGenerator(name string, seed int64) (sdktrace.IDGenerator, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "random":
+		return nil, nil
+	case "seeded":
+		return newSeededIDGenerator(seed), nil
+	}
+	return nil, fmt.Errorf("unknown ID generator %q, want %q or %q", name, "random", "seeded")
+}
+
+// seededIDGenerator draws IDs from a pseudo-random sequence, so the same
+// seed and the same order of spans give the same IDs on every run.
+type seededIDGenerator struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+var _ sdktrace.IDGenerator = (*seededIDGenerator)(nil)
+
+func newSeededIDGenerator(seed int64) *seededIDGenerator {
+	return &seededIDGenerator{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (g *seededIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var tid trace.TraceID
+	for !tid.IsValid() {
+		g.rng.Read(tid[:])
+	}
+	return tid, g.newSpanIDLocked()
+}
+
+func (g *seededIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.newSpanIDLocked()
+}
+
+func (g *seededIDGenerator) newSpanIDLocked() trace.SpanID {
+	var sid trace.SpanID
+	for !sid.IsValid() {
+		g.rng.Read(sid[:])
+	}
+	return sid
+}
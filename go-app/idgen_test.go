@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fixedIDGenerator hands out the same IDs every time.
+type fixedIDGenerator struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+func (g fixedIDGenerator) NewIDs(context.Context) (trace.TraceID, trace.SpanID) {
+	return g.traceID, g.spanID
+}
+
+func (g fixedIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return g.spanID
+}
+
+func TestTracerProviderUsesIDGenerator(t *testing.T) {
+	gen := fixedIDGenerator{
+		traceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		spanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	}
+	cfg := testConfig()
+	cfg.IDGenerator = gen
+
+	// Accepts the spans exported on shutdown
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(collector.Close)
+
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	target := newOTLPTarget(otlpProtocolHTTP, nil, strings.TrimPrefix(collector.URL, "http://"), nil)
+	tp, err := newTracerProvider(ctx, cfg, resource.Empty(), target, noop.NewMeterProvider().Meter("test"), sdktrace.AlwaysSample(), nil, newSpanQueueTracker(), recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(ctx, "request")
+	span.End()
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := recorder.Ended()[0].SpanContext()
+	if sc.TraceID() != gen.traceID || sc.SpanID() != gen.spanID {
+		t.Errorf("span IDs = %s/%s, want %s/%s", sc.TraceID(), sc.SpanID(), gen.traceID, gen.spanID)
+	}
+}
+
+func TestSeededIDGeneratorRepeats(t *testing.T) {
+	ctx := context.Background()
+	a, b := newSeededIDGenerator(42), newSeededIDGenerator(42)
+	for i := 0; i < 3; i++ {
+		traceA, spanA := a.NewIDs(ctx)
+		traceB, spanB := b.NewIDs(ctx)
+		if traceA != traceB || spanA != spanB {
+			t.Fatalf("IDs %d differ for the same seed: %s/%s and %s/%s", i, traceA, spanA, traceB, spanB)
+		}
+	}
+}
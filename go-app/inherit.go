@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type inheritedAttrsContextKey struct{}
+
+// inheritAttributes sets attrs on the span in ctx and returns a context in
+// which those whose keys are in inherit are added to every span started by
+// startSpan, along with any inherited already, so a trace's DB calls and
+// other leaves can be filtered on them in Tempo like its server span. A
+// later value for a key replaces an earlier one.
+func inheritAttributes(ctx context.Context, inherit map[attribute.Key]bool, attrs ...attribute.KeyValue) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+
+	inherited := inheritedAttributes(ctx)
+	added := false
+	for _, kv := range attrs {
+		if inherit[kv.Key] {
+			inherited = append(inherited[:len(inherited):len(inherited)], kv)
+			added = true
+		}
+	}
+	if !added {
+		return ctx
+	}
+	return context.WithValue(ctx, inheritedAttrsContextKey{}, inherited)
+}
+
+// inheritedAttributes returns the attributes stored by inheritAttributes.
+// The slice must not be modified.
+func inheritedAttributes(ctx context.Context) []attribute.KeyValue {
+	attrs, _ := ctx.Value(inheritedAttrsContextKey{}).([]attribute.KeyValue)
+	return attrs
+}
+
+// startSpan starts a span like tracer.Start, with the attributes inherited
+// through ctx. Attributes in opts take precedence over inherited ones.
+func startSpan(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if attrs := inheritedAttributes(ctx); len(attrs) > 0 {
+		opts = append([]trace.SpanStartOption{trace.WithAttributes(attrs...)}, opts...)
+	}
+	return tracer.Start(ctx, name, opts...)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instruments caches the instruments created through getOrCreate.
+var instruments = newInstrumentRegistry()
+
+type instrumentKey struct {
+	provider metric.MeterProvider
+	meter    string
+	name     string
+}
+
+// instrumentDefinition is what makes two instruments with the same name
+// compatible: they must come from the same meter with the same kind and unit.
+type instrumentDefinition struct {
+	meter string
+	kind  string
+	unit  string
+}
+
+func (d instrumentDefinition) String() string {
+	return fmt.Sprintf("%s %s (unit %q)", d.meter, d.kind, d.unit)
+}
+
+// instrumentRegistry hands out one instrument per meter provider, meter and
+// name, and checks every instrument definition in the app against the
+// others. The SDK only logs a warning for conflicting definitions of a name
+// and exports one of them, leaving the other metric silently missing; here
+// the conflict is an error from the instrument constructor, which fails
+// startup.
+type instrumentRegistry struct {
+	mu          sync.Mutex
+	instruments map[instrumentKey]any
+
+	defsMu      sync.Mutex
+	definitions map[string]instrumentDefinition
+
+	// Set by routeHighFrequency
+	route atomic.Pointer[highFrequencyRoute]
+}
+
+func newInstrumentRegistry() *instrumentRegistry {
+	return &instrumentRegistry{
+		instruments: make(map[instrumentKey]any),
+		definitions: make(map[string]instrumentDefinition),
+	}
+}
+
+// define records the definition of instrument name, failing if a different
+// definition of it exists. Definitions are shared by all meter providers,
+// since tenant providers run the same instrumentation code.
+func (r *instrumentRegistry) define(name string, def instrumentDefinition) error {
+	r.defsMu.Lock()
+	defer r.defsMu.Unlock()
+	if prev, ok := r.definitions[name]; ok && prev != def {
+		return fmt.Errorf("conflicting definitions of instrument %q: %s and %s", name, prev, def)
+	}
+	r.definitions[name] = def
+	return nil
+}
+
+// Meter returns the named meter of mp, with every instrument it creates
+// checked by define. For the provider routed by routeHighFrequency, the
+// high-frequency instruments are created on the fast provider's meter.
+func (r *instrumentRegistry) Meter(mp metric.MeterProvider, name string) metric.Meter {
+	m := &checkedMeter{Meter: mp.Meter(name), r: r, name: name}
+	if rt := r.route.Load(); rt != nil && rt.main == mp {
+		m.fast, m.route = rt.fast.Meter(name), rt
+	}
+	return m
+}
+
+// appMeter returns a checked meter of the global meter provider.
+func appMeter(name string) metric.Meter {
+	return instruments.Meter(otel.GetMeterProvider(), name)
+}
+
+// getOrCreate returns the instrument called name from meter of mp, calling
+// create with the checked meter the first time it is asked for.
+func getOrCreate[T any](r *instrumentRegistry, mp metric.MeterProvider, meter, name string, create func(m metric.Meter, name string) (T, error)) (T, error) {
+	var zero T
+	key := instrumentKey{provider: mp, meter: meter, name: name}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if inst, ok := r.instruments[key]; ok {
+		typed, ok := inst.(T)
+		if !ok {
+			return zero, fmt.Errorf("instrument %q of meter %q already registered as %T", name, meter, inst)
+		}
+		return typed, nil
+	}
+
+	inst, err := create(r.Meter(mp, meter), name)
+	if err != nil {
+		return zero, err
+	}
+	r.instruments[key] = inst
+	return inst, nil
+}
+
+// forget drops the instruments of mp, once it has been shut down.
+func (r *instrumentRegistry) forget(mp metric.MeterProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.instruments {
+		if key.provider == mp {
+			delete(r.instruments, key)
+		}
+	}
+}
+
+// checkedMeter defines every instrument in its registry before creating it.
+type checkedMeter struct {
+	metric.Meter
+	r    *instrumentRegistry
+	name string
+
+	// fast is the meter the instruments named by route are created on, if
+	// any
+	fast  metric.Meter
+	route *highFrequencyRoute
+}
+
+// meterFor returns the meter instrument name is created on.
+func (m *checkedMeter) meterFor(name string) metric.Meter {
+	if m.fast != nil && m.route.names[name] {
+		m.route.markRouted(name)
+		return m.fast
+	}
+	return m.Meter
+}
+
+func (m *checkedMeter) define(name, kind, unit string) error {
+	return m.r.define(name, instrumentDefinition{meter: m.name, kind: kind, unit: unit})
+}
+
+func (m *checkedMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	if err := m.define(name, "Int64Counter", metric.NewInt64CounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Int64Counter(name, opts...)
+}
+
+func (m *checkedMeter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	if err := m.define(name, "Int64UpDownCounter", metric.NewInt64UpDownCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Int64UpDownCounter(name, opts...)
+}
+
+func (m *checkedMeter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	if err := m.define(name, "Int64Histogram", metric.NewInt64HistogramConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Int64Histogram(name, opts...)
+}
+
+func (m *checkedMeter) Int64ObservableCounter(name string, opts ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	if err := m.define(name, "Int64ObservableCounter", metric.NewInt64ObservableCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Int64ObservableCounter, error) {
+		return meter.Int64ObservableCounter(name, opts...)
+	})
+}
+
+func (m *checkedMeter) Int64ObservableUpDownCounter(name string, opts ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	if err := m.define(name, "Int64ObservableUpDownCounter", metric.NewInt64ObservableUpDownCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Int64ObservableUpDownCounter, error) {
+		return meter.Int64ObservableUpDownCounter(name, opts...)
+	})
+}
+
+func (m *checkedMeter) Int64ObservableGauge(name string, opts ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	if err := m.define(name, "Int64ObservableGauge", metric.NewInt64ObservableGaugeConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Int64ObservableGauge, error) {
+		return meter.Int64ObservableGauge(name, opts...)
+	})
+}
+
+func (m *checkedMeter) Float64Counter(name string, opts ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	if err := m.define(name, "Float64Counter", metric.NewFloat64CounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Float64Counter(name, opts...)
+}
+
+func (m *checkedMeter) Float64UpDownCounter(name string, opts ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	if err := m.define(name, "Float64UpDownCounter", metric.NewFloat64UpDownCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Float64UpDownCounter(name, opts...)
+}
+
+func (m *checkedMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	if err := m.define(name, "Float64Histogram", metric.NewFloat64HistogramConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return m.meterFor(name).Float64Histogram(name, opts...)
+}
+
+func (m *checkedMeter) Float64ObservableCounter(name string, opts ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	if err := m.define(name, "Float64ObservableCounter", metric.NewFloat64ObservableCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Float64ObservableCounter, error) {
+		return meter.Float64ObservableCounter(name, opts...)
+	})
+}
+
+func (m *checkedMeter) Float64ObservableUpDownCounter(name string, opts ...metric.Float64ObservableUpDownCounterOption) (metric.Float64ObservableUpDownCounter, error) {
+	if err := m.define(name, "Float64ObservableUpDownCounter", metric.NewFloat64ObservableUpDownCounterConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Float64ObservableUpDownCounter, error) {
+		return meter.Float64ObservableUpDownCounter(name, opts...)
+	})
+}
+
+func (m *checkedMeter) Float64ObservableGauge(name string, opts ...metric.Float64ObservableGaugeOption) (metric.Float64ObservableGauge, error) {
+	if err := m.define(name, "Float64ObservableGauge", metric.NewFloat64ObservableGaugeConfig(opts...).Unit()); err != nil {
+		return nil, err
+	}
+	return observableOn(m, name, func(meter metric.Meter) (metric.Float64ObservableGauge, error) {
+		return meter.Float64ObservableGauge(name, opts...)
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// concurrencyLimiter bounds how many requests run a handler at once. Requests
+// over the limit wait for a free slot, or give up with 503 if the client goes
+// away first.
+type concurrencyLimiter struct {
+	slots chan struct{}
+	wait  metric.Float64Histogram
+	hold  metric.Float64Histogram
+}
+
+func newConcurrencyLimiter(meter metric.Meter, limit int) (*concurrencyLimiter, error) {
+	wait, err := meter.Float64Histogram(
+		"http.server.semaphore.wait_duration",
+		metric.WithDescription("Time requests waited for a concurrency slot"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	hold, err := meter.Float64Histogram(
+		"http.server.semaphore.hold_duration",
+		metric.WithDescription("Time requests held a concurrency slot"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, limit),
+		wait:  wait,
+		hold:  hold,
+	}, nil
+}
+
+// Wrap limits next. Wait and hold times are recorded separately so
+// contention can be told apart from processing time.
+func (l *concurrencyLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		attrs := metric.WithAttributes(attribute.String("path", r.URL.Path))
+
+		start := time.Now()
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.wait.Record(ctx, toMillis(time.Since(start)), attrs)
+			writeError(w, trace.SpanFromContext(ctx), errOverloaded, http.StatusServiceUnavailable, "server busy")
+			return
+		}
+		acquired := time.Now()
+		l.wait.Record(ctx, toMillis(acquired.Sub(start)), attrs)
+
+		defer func() {
+			<-l.slots
+			l.hold.Record(ctx, toMillis(time.Since(acquired)), attrs)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
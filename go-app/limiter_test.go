@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestConcurrencyLimiterShedsInsideServerSpan(t *testing.T) {
+	recorder := useTestTracerProvider(t)
+	limiter, err := newConcurrencyLimiter(noop.NewMeterProvider().Meter("test"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every slot taken, so the request waits until its client gives up
+	limiter.slots <- struct{}{}
+	handler := newServerHandler(limiter.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil).WithContext(ctx))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans ended, want the server span", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("span status = %v, want Error", spans[0].Status())
+	}
+	var errorType string
+	for _, kv := range spans[0].Attributes() {
+		if kv.Key == "error.type" {
+			errorType = kv.Value.AsString()
+		}
+	}
+	if errorType != string(errOverloaded) {
+		t.Errorf("error.type = %q, want %q", errorType, errOverloaded)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// loadGenerator emits synthetic traces at a fixed rate to load-test a trace
+// backend. Each trace has spansPerTrace spans arranged in a random tree at
+// most depth levels deep, and every span carries one attribute of
+// attributeSize bytes.
+type loadGenerator struct {
+	tracesPerSecond float64
+	spansPerTrace   int
+	depth           int
+	attributeSize   int
+
+	spans atomic.Int64
+}
+
+// maxLoadGenTracesPerSecond is the highest rate the generator's ticker can
+// run at: one trace a nanosecond.
+const maxLoadGenTracesPerSecond = 1e9
+
+func newLoadGenerator(tracesPerSecond float64, spansPerTrace, depth, attributeSize int) *loadGenerator {
+	return &loadGenerator{
+		tracesPerSecond: min(max(tracesPerSecond, 0.001), maxLoadGenTracesPerSecond),
+		spansPerTrace:   max(spansPerTrace, 1),
+		depth:           max(depth, 1),
+		attributeSize:   max(attributeSize, 0),
+	}
+}
+
+// registerRateGauge reports the achieved spans per second, which falls below
+// the configured rate when the generator or exporter can't keep up.
+func (g *loadGenerator) registerRateGauge() error {
+	var mu sync.Mutex
+	last, lastAt := int64(0), time.Now()
+	_, err := appMeter("go-sample-app/loadgen").Float64ObservableGauge(
+		"loadgen.spans.rate",
+		metric.WithDescription("Synthetic spans generated per second since the previous collection"),
+		metric.WithUnit("{span}/s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			mu.Lock()
+			defer mu.Unlock()
+			now, spans := time.Now(), g.spans.Load()
+			if elapsed := now.Sub(lastAt).Seconds(); elapsed > 0 {
+				o.Observe(float64(spans-last) / elapsed)
+			}
+			last, lastAt = spans, now
+			return nil
+		}),
+	)
+	return err
+}
+
+// run generates traces until ctx is done.
+func (g *loadGenerator) run(ctx context.Context) {
+	tracer := otel.Tracer("go-sample-app/loadgen")
+	value := strings.Repeat("x", g.attributeSize)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.tracesPerSecond))
+	defer ticker.Stop()
+
+	zap.L().Info("generating synthetic traces",
+		zap.Float64("traces_per_second", g.tracesPerSecond),
+		zap.Int("spans_per_trace", g.spansPerTrace),
+		zap.Int("depth", g.depth),
+		zap.Int("attribute_size", g.attributeSize),
+	)
+	for {
+		select {
+		case <-ticker.C:
+			g.trace(ctx, tracer, value)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// trace emits one synthetic trace. Spans are started parents first and
+// ended in reverse, so every child ends before its parent.
+func (g *loadGenerator) trace(ctx context.Context, tracer trace.Tracer, value string) {
+	type node struct {
+		ctx   context.Context
+		span  trace.Span
+		depth int
+	}
+
+	nodes := make([]node, 0, g.spansPerTrace)
+	rootCtx, root := tracer.Start(ctx, "synthetic.root",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("synthetic.payload", value)),
+	)
+	nodes = append(nodes, node{ctx: rootCtx, span: root, depth: 1})
+
+	// Only spans above the maximum depth can take children
+	parents := []int{}
+	if g.depth > 1 {
+		parents = append(parents, 0)
+	}
+	for i := 1; i < g.spansPerTrace && len(parents) > 0; i++ {
+		parent := nodes[parents[rand.Intn(len(parents))]]
+		childCtx, child := tracer.Start(parent.ctx, "synthetic.span."+strconv.Itoa(parent.depth+1),
+			trace.WithAttributes(attribute.String("synthetic.payload", value)),
+		)
+		nodes = append(nodes, node{ctx: childCtx, span: child, depth: parent.depth + 1})
+		if parent.depth+1 < g.depth {
+			parents = append(parents, len(nodes)-1)
+		}
+	}
+
+	for i := len(nodes) - 1; i >= 0; i-- {
+		nodes[i].span.End()
+	}
+	g.spans.Add(int64(len(nodes)))
+}
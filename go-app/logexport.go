@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Log export settings, mirroring the batch span processor: records are
+// exported every logExportInterval or as soon as logExportBatchSize are
+// waiting, and dropped rather than blocking the caller once logQueueSize are
+// queued. A batch that fails to export is dropped.
+const (
+	logExportInterval  = time.Second
+	logExportBatchSize = 512
+	logQueueSize       = 2048
+)
+
+// spanContextMarker carries the span a logger's entries belong to. Like
+// sampledTraceMarker it is a skip field, so encoders never write it.
+type spanContextMarker struct {
+	sc trace.SpanContext
+}
+
+// spanContextField returns the field that ties a logger's entries to sc in
+// OTLP log records, for trace-to-logs correlation. Pass it to Logger.With.
+func spanContextField(sc trace.SpanContext) zap.Field {
+	return zap.Field{Type: zapcore.SkipType, Interface: spanContextMarker{sc: sc}}
+}
+
+// traceIDField logs the trace ID of sc as trace_id. Without a valid trace ID,
+// as when tracing is disabled and spans come from a no-op provider, the
+// field is left out rather than logged as all zeros, which would match
+// every other untraced entry.
+func traceIDField(sc trace.SpanContext) zap.Field {
+	if !sc.HasTraceID() {
+		return zap.Skip()
+	}
+	return zap.String("trace_id", sc.TraceID().String())
+}
+
+// loggerProvider batches log records and exports them over OTLP to a target,
+// with the same resource as traces and metrics.
+type loggerProvider struct {
+	res *logspb.ResourceLogs // resource and scope, without records
+	exp *otlpLogExporter
+
+	// minLevel is the least severe level exported, on top of the stdout
+	// logger's own level
+	minLevel zapcore.Level
+
+	queue   chan *logspb.LogRecord
+	flushes chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// initLoggerProvider starts exporting log records at minLevel and above to
+// target. Zap entries reach it through the core returned by newOTLPLogCore.
+func initLoggerProvider(res *resource.Resource, target *otlpTarget, minLevel zapcore.Level) *loggerProvider {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = target.tls
+	p := &loggerProvider{
+		res: &logspb.ResourceLogs{
+			Resource:  &resourcepb.Resource{Attributes: attrsToOTLP(res.Attributes())},
+			SchemaUrl: res.SchemaURL(),
+		},
+		exp:      &otlpLogExporter{target: target, client: &http.Client{Timeout: exportTimeout, Transport: transport}},
+		minLevel: minLevel,
+		queue:    make(chan *logspb.LogRecord, logQueueSize),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// emit queues a record for export, dropping it if the queue is full.
+func (p *loggerProvider) emit(rec *logspb.LogRecord) {
+	select {
+	case p.queue <- rec:
+	default:
+	}
+}
+
+func (p *loggerProvider) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(logExportInterval)
+	defer ticker.Stop()
+
+	var batch []*logspb.LogRecord
+	export := func() {
+		if len(batch) > 0 {
+			p.export(batch)
+			batch = nil
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case rec := <-p.queue:
+				batch = append(batch, rec)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case rec := <-p.queue:
+			if batch = append(batch, rec); len(batch) >= logExportBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-p.flushes:
+			drain()
+			export()
+			close(flushed)
+		case <-p.done:
+			drain()
+			export()
+			return
+		}
+	}
+}
+
+func (p *loggerProvider) export(batch []*logspb.LogRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	rl := proto.Clone(p.res).(*logspb.ResourceLogs)
+	rl.ScopeLogs = []*logspb.ScopeLogs{{
+		Scope:      &commonpb.InstrumentationScope{Name: "go-sample-app"},
+		LogRecords: batch,
+	}}
+	err := p.exp.export(ctx, &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{rl}})
+	f := p.exp.target.failures
+	f.record(&f.logs, err)
+	if err != nil {
+		otel.Handle(logExportError{fmt.Errorf("logs export: %w", err)})
+	}
+}
+
+// logExportError marks errors from the OTLP log exporter. The error handler
+// writes them to stderr only: logging them would queue more records for the
+// exporter that just failed, and so on for as long as it keeps failing.
+type logExportError struct {
+	err error
+}
+
+func (e logExportError) Error() string { return e.err.Error() }
+func (e logExportError) Unwrap() error { return e.err }
+
+// fatalFlushHook exports the queued log records, the fatal one included,
+// before exiting. zap's default hook exits right away, skipping the
+// deferred shutdown that would otherwise flush them.
+type fatalFlushHook struct {
+	logs *loggerProvider
+}
+
+func (h fatalFlushHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer os.Exit(1)
+	defer cancel()
+	if err := h.logs.Shutdown(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to shut down logger provider: %v\n", err)
+	}
+}
+
+// ForceFlush exports every record queued so far.
+func (p *loggerProvider) ForceFlush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case p.flushes <- flushed:
+	case <-p.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued records and stops exporting. Records emitted
+// afterwards are dropped once the queue fills.
+func (p *loggerProvider) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.done) })
+	select {
+	case <-p.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.exp.shutdown()
+}
+
+// otlpLogExporter sends log export requests to an otlpTarget over its
+// protocol. The OTel Go logs SDK is not released for the SDK version
+// this app uses, so it speaks OTLP directly using the generated protobuf
+// types.
+type otlpLogExporter struct {
+	target *otlpTarget
+	client *http.Client
+
+	mu      sync.Mutex
+	version uint64
+	conn    *grpc.ClientConn // dialed lazily for the current target
+}
+
+func (e *otlpLogExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	endpoint, headers, version := e.target.snapshot()
+
+	var resp *collogspb.ExportLogsServiceResponse
+	var err error
+	if e.target.protocol == otlpProtocolGRPC {
+		resp, err = e.exportGRPC(ctx, endpoint, headers, version, req)
+	} else {
+		resp, err = e.exportHTTP(ctx, endpoint, headers, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Reported the way the trace and metric exporters report it, so the
+	// error handler counts it
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedLogRecords() > 0 {
+		otel.Handle(logExportError{fmt.Errorf("OTLP partial success: %s (%d log records rejected)", ps.GetErrorMessage(), ps.GetRejectedLogRecords())})
+	}
+	return nil
+}
+
+func (e *otlpLogExporter) exportHTTP(ctx context.Context, endpoint string, headers map[string]string, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if e.target.tls == nil {
+		scheme = "http"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+endpoint+"/v1/logs", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("failed to send logs to %s: %s", httpReq.URL, httpResp.Status)
+	}
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if err := proto.Unmarshal(respBody, resp); err != nil {
+		// A collector may answer with an empty or non-protobuf body
+		return &collogspb.ExportLogsServiceResponse{}, nil
+	}
+	return resp, nil
+}
+
+func (e *otlpLogExporter) exportGRPC(ctx context.Context, endpoint string, headers map[string]string, version uint64, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	e.mu.Lock()
+	if e.conn == nil || e.version != version {
+		creds := insecure.NewCredentials()
+		if e.target.tls != nil {
+			creds = credentials.NewTLS(e.target.tls)
+		}
+		target, dialOpts := grpcTarget(endpoint)
+		conn, err := grpc.Dial(target, append(dialOpts, grpc.WithTransportCredentials(creds), withConnState("logs"))...)
+		if err != nil {
+			e.mu.Unlock()
+			return nil, err
+		}
+		if e.conn != nil {
+			e.conn.Close()
+		}
+		e.conn, e.version = conn, version
+	}
+	client := collogspb.NewLogsServiceClient(e.conn)
+	e.mu.Unlock()
+
+	if len(headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(headers))
+	}
+	return client.Export(ctx, req)
+}
+
+func (e *otlpLogExporter) shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	return e.conn.Close()
+}
+
+// otlpLogCore turns zap entries into OTLP log records for a loggerProvider.
+// It is meant to be teed with the stdout core, whose level it shares, raised
+// to the provider's minLevel.
+type otlpLogCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+	p      *loggerProvider
+}
+
+func newOTLPLogCore(enab zapcore.LevelEnabler, p *loggerProvider) zapcore.Core {
+	return &otlpLogCore{
+		LevelEnabler: zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l >= p.minLevel && enab.Enabled(l)
+		}),
+		p: p,
+	}
+}
+
+func (c *otlpLogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &otlpLogCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+		p:            c.p,
+	}
+}
+
+func (c *otlpLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otlpLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// Wrapping cores may write through the tee without checking each core
+	if !c.Enabled(ent.Level) {
+		return nil
+	}
+	all := append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	c.p.emit(logRecordFromEntry(ent, all))
+	return nil
+}
+
+// Sync does nothing: records are exported in the background, and flushing
+// on every Sync would turn it into a network call.
+func (c *otlpLogCore) Sync() error { return nil }
+
+// logRecordFromEntry converts a zap entry and its fields to an OTLP log
+// record. The trace context comes from a spanContextField, or failing that
+// from a trace_id field.
+func logRecordFromEntry(ent zapcore.Entry, fields []zapcore.Field) *logspb.LogRecord {
+	rec := &logspb.LogRecord{
+		TimeUnixNano:         uint64(ent.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       logSeverity(ent.Level),
+		SeverityText:         ent.Level.CapitalString(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: ent.Message}},
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	var sc trace.SpanContext
+	for _, f := range fields {
+		if m, ok := f.Interface.(spanContextMarker); ok && f.Type == zapcore.SkipType {
+			sc = m.sc
+			continue
+		}
+		f.AddTo(enc)
+	}
+	if ent.LoggerName != "" {
+		enc.AddString("logger", ent.LoggerName)
+	}
+
+	if sc.IsValid() {
+		traceID, spanID := sc.TraceID(), sc.SpanID()
+		rec.TraceId, rec.SpanId = traceID[:], spanID[:]
+		rec.Flags = uint32(sc.TraceFlags())
+	} else if s, ok := enc.Fields["trace_id"].(string); ok {
+		if traceID, err := hex.DecodeString(s); err == nil && len(traceID) == 16 {
+			rec.TraceId = traceID
+		}
+	}
+
+	rec.Attributes = mapToOTLP(enc.Fields)
+	return rec
+}
+
+func logSeverity(l zapcore.Level) logspb.SeverityNumber {
+	switch {
+	case l <= zapcore.DebugLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case l == zapcore.InfoLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case l == zapcore.WarnLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case l == zapcore.ErrorLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+}
+
+// mapToOTLP converts fields encoded by a zapcore.MapObjectEncoder, sorted by
+// key for stable output.
+func mapToOTLP(m map[string]any) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*commonpb.KeyValue, 0, len(m))
+	for _, k := range keys {
+		out = append(out, &commonpb.KeyValue{Key: k, Value: anyToOTLP(m[k])})
+	}
+	return out
+}
+
+func anyToOTLP(v any) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case time.Duration:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Format(time.RFC3339Nano)}}
+	case map[string]any:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: mapToOTLP(v)}}}
+	case []any:
+		arr := &commonpb.ArrayValue{Values: make([]*commonpb.AnyValue, 0, len(v))}
+		for _, e := range v {
+			arr.Values = append(arr.Values, anyToOTLP(e))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+}
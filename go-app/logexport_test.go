@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTraceIDFieldSkipsNoopSpans(t *testing.T) {
+	_, span := noop.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	if got := traceIDField(span.SpanContext()); !got.Equals(zap.Skip()) {
+		t.Errorf("traceIDField = %#v, want zap.Skip()", got)
+	}
+}
+
+func TestTraceIDFieldLogsValidTraceID(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	want := zap.String("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736")
+	if got := traceIDField(sc); !got.Equals(want) {
+		t.Errorf("traceIDField = %#v, want %#v", got, want)
+	}
+}
+
+func TestOTLPLogCoreSetsTraceContext(t *testing.T) {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	_, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	sc := span.SpanContext()
+
+	// Not started, so records stay in the queue
+	p := &loggerProvider{minLevel: zapcore.InfoLevel, queue: make(chan *logspb.LogRecord, 1)}
+	logger := zap.New(newOTLPLogCore(zapcore.DebugLevel, p)).With(spanContextField(sc))
+	logger.Info("handling request")
+
+	rec := <-p.queue
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	if !bytes.Equal(rec.TraceId, traceID[:]) {
+		t.Errorf("TraceId = %x, want %s", rec.TraceId, traceID)
+	}
+	if !bytes.Equal(rec.SpanId, spanID[:]) {
+		t.Errorf("SpanId = %x, want %s", rec.SpanId, spanID)
+	}
+	if rec.Flags != uint32(trace.FlagsSampled) {
+		t.Errorf("Flags = %d, want %d", rec.Flags, trace.FlagsSampled)
+	}
+}
+
+func TestErrorHandlerKeepsLogExportErrorsOutOfTheLogger(t *testing.T) {
+	prev := otel.GetErrorHandler()
+	t.Cleanup(func() { otel.SetErrorHandler(prev) })
+	core, logged := observer.New(zapcore.DebugLevel)
+	if err := initErrorHandler(zap.New(core)); err != nil {
+		t.Fatal(err)
+	}
+
+	otel.Handle(logExportError{errors.New("logs export: connection refused")})
+	otel.Handle(logExportError{errors.New("OTLP partial success: too old (2 log records rejected)")})
+	if n := logged.Len(); n != 0 {
+		t.Errorf("logged %d entries for log export errors, want none", n)
+	}
+
+	otel.Handle(errors.New("traces export: connection refused"))
+	if n := logged.Len(); n != 1 {
+		t.Errorf("logged %d entries for a trace export error, want 1", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelProbability is the chance of a request emitting a log at level.
+type levelProbability struct {
+	level zapcore.Level
+	p     float64
+}
+
+// demoLogMessages are the messages emitted at each drawn level.
+var demoLogMessages = map[zapcore.Level]string{
+	zapcore.DebugLevel: "cache lookup details",
+	zapcore.InfoLevel:  "request processed normally",
+	zapcore.WarnLevel:  "request took a slow path",
+	zapcore.ErrorLevel: "simulated downstream failure",
+}
+
+// parseLogLevelMix parses comma-separated level=probability pairs, e.g.
+// "error=0.01,warn=0.05". Requests not drawn for any listed level log at info.
+func parseLogLevelMix(v string) ([]levelProbability, error) {
+	if v == "" {
+		return nil, nil
+	}
+	var mix []levelProbability
+	var total float64
+	for _, pair := range strings.Split(v, ",") {
+		name, prob, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid LOG_LEVEL_PROBABILITIES entry %q", pair)
+		}
+		level, err := zapcore.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := demoLogMessages[level]; !ok {
+			return nil, fmt.Errorf("unsupported log level %q", name)
+		}
+		p, err := strconv.ParseFloat(prob, 64)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid probability for %s: %q", name, prob)
+		}
+		total += p
+		mix = append(mix, levelProbability{level: level, p: p})
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("log level probabilities add up to %g, more than 1", total)
+	}
+	return mix, nil
+}
+
+// emitDemoLog logs one message at a level drawn from mix.
+func emitDemoLog(logger *zap.Logger, mix []levelProbability, fields ...zap.Field) {
+	level := zapcore.InfoLevel
+	r := rand.Float64()
+	for _, lp := range mix {
+		if r < lp.p {
+			level = lp.level
+			break
+		}
+		r -= lp.p
+	}
+	logger.Log(level, demoLogMessages[level], fields...)
+}
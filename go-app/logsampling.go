@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Log sampling rates, matching zap's production defaults: per second, the
+// first logSampleInitial entries with a given level and message are logged,
+// then every logSampleThereafter-th.
+const (
+	logSampleTick       = time.Second
+	logSampleInitial    = 100
+	logSampleThereafter = 100
+)
+
+// sampledTraceMarker tags a logger as belonging to a sampled trace. It is a
+// skip field, so encoders never write it.
+type sampledTraceMarker struct{}
+
+// sampledTraceField returns the field that exempts a logger's entries from
+// log sampling when trace affinity is on. Pass it to Logger.With.
+func sampledTraceField() zap.Field {
+	return zap.Field{Type: zapcore.SkipType, Interface: sampledTraceMarker{}}
+}
+
+func hasSampledTraceField(fields []zapcore.Field) bool {
+	for _, f := range fields {
+		if _, ok := f.Interface.(sampledTraceMarker); ok && f.Type == zapcore.SkipType {
+			return true
+		}
+	}
+	return false
+}
+
+// affinityCore applies log sampling only to entries that don't belong to a
+// sampled trace, so a trace that was kept always has all of its logs.
+// Loggers derived with sampledTraceField bypass the sampler.
+type affinityCore struct {
+	zapcore.Core              // unsampled
+	sampled      zapcore.Core // the same core behind the log sampler
+	keep         bool
+}
+
+func newAffinityCore(core zapcore.Core) zapcore.Core {
+	return &affinityCore{
+		Core:    core,
+		sampled: zapcore.NewSamplerWithOptions(core, logSampleTick, logSampleInitial, logSampleThereafter),
+	}
+}
+
+func (c *affinityCore) With(fields []zapcore.Field) zapcore.Core {
+	return &affinityCore{
+		Core:    c.Core.With(fields),
+		sampled: c.sampled.With(fields),
+		keep:    c.keep || hasSampledTraceField(fields),
+	}
+}
+
+func (c *affinityCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.keep {
+		return c.Core.Check(ent, ce)
+	}
+	return c.sampled.Check(ent, ce)
+}
+
+// Write is reached when a wrapping core, such as scrubCore, checked the entry
+// itself, so the sampling decision has to be made here as well.
+func (c *affinityCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.keep && !hasSampledTraceField(fields) && c.sampled.Check(ent, nil) == nil {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
@@ -2,95 +2,251 @@ package main
 
 import (
 	"context"
-	"github.com/pyroscope-io/client/pyroscope"
+	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelruntime "go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/codes"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func initTracer(ctx context.Context, otelCollector string) (*sdktrace.TracerProvider, error) {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("go-sample-app"),
-			semconv.ServiceVersion("1.0.0"),
-		),
+// processStartTime is when the process booted, close enough: package
+// variables are initialized before main runs.
+var processStartTime = time.Now()
+
+// newResource describes the service configured in cfg and the host and
+// process it runs as, plus any OTEL_RESOURCE_ATTRIBUTES. It is built once in
+// main and shared by every provider, so all signals carry the same resource.
+// cfg.ResourceSchemaURL pins the semantic conventions schema the attributes are reported
+// against; some backends validate it. process.start_time changes on every
+// restart, so uptime and restarts can be read off any signal. The Go version,
+// as process.runtime.version, comes from the process detector.
+//
+// A detector failing leaves its attributes out, and the partial resource is
+// returned along with an error wrapping resource.ErrPartialResource.
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+		attribute.String("process.start_time", processStartTime.UTC().Format(time.RFC3339Nano)),
+		// The same binary behaves differently under a tighter CPU limit
+		attribute.Int("go.maxprocs", runtime.GOMAXPROCS(0)),
+	}
+	if cfg.DeploymentEnvironment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.DeploymentEnvironment))
+	}
+	detected, err := resource.New(ctx,
+		resource.WithHost(),
+		resource.WithProcess(),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
 	)
-	if err != nil {
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
 		return nil, err
 	}
 
-	traceExp, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(otelCollector),
-		otlptracehttp.WithInsecure(),
-	)
+	// The detectors report against the SDK's own schema version, which would
+	// conflict with the configured one on a merge, so their attributes are re-homed.
+	// Later duplicates win, so the app's own configuration overrides them.
+	return resource.NewWithAttributes(cfg.ResourceSchemaURL, append(detected.Attributes(), attrs...)...), err
+}
+
+func initTracer(ctx context.Context, cfg Config, res *resource.Resource, target *otlpTarget, sampler sdktrace.Sampler, scrub *scrubber, queue *spanQueueTracker, processors ...sdktrace.SpanProcessor) (*sdktrace.TracerProvider, error) {
+	tp, err := newTracerProvider(ctx, cfg, res, target, appMeter("go-sample-app/exporter"), sampler, scrub, queue, processors...)
 	if err != nil {
 		return nil, err
 	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExp),
-		sdktrace.WithResource(res),
-	)
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(newPropagator())
 	return tp, nil
 }
 
-func initMeter(ctx context.Context, otelCollector string) (*sdkmetric.MeterProvider, error) {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("go-sample-app"),
-			semconv.ServiceVersion("1.0.0"),
-		),
+// newPropagator reads and writes W3C trace context and baggage, so requests
+// continue the trace of an upstream that sent a traceparent.
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
 	)
+}
+
+// newTracerProvider builds a tracer provider exporting to target with the
+// span settings in cfg, tracking the spans waiting in its batch span
+// processor in queue and counting the spans it fails to export on meter. It
+// does not install it globally. On error, the exporters it already created are
+// shut down, so a failed attempt can simply be retried.
+func newTracerProvider(ctx context.Context, cfg Config, res *resource.Resource, target *otlpTarget, meter metric.Meter, sampler sdktrace.Sampler, scrub *scrubber, queue *spanQueueTracker, processors ...sdktrace.SpanProcessor) (*sdktrace.TracerProvider, error) {
+	otlpExp, err := newTargetSpanExporter(ctx, target)
 	if err != nil {
 		return nil, err
 	}
+	traceExp, err := newDroppedSpansExporter(otlpExp, meter)
+	if err != nil {
+		// Close its connection rather than leak one per startup attempt
+		return nil, multierr.Append(err, otlpExp.Shutdown(ctx))
+	}
 
-	metricExp, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint(otelCollector),
-		otlpmetrichttp.WithInsecure(),
+	// Queue up to cfg.SpanQueueSize spans for export. Without WithBlocking the
+	// processor drops new spans once the queue is full, as during an outage,
+	// rather than blocking the requests that end them.
+	var exportProcessor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(
+		&queueTrackingExporter{SpanExporter: traceExp, t: queue},
+		sdktrace.WithMaxQueueSize(cfg.SpanQueueSize),
+		sdktrace.WithMaxExportBatchSize(cfg.SpanBatchSize),
+		sdktrace.WithBatchTimeout(cfg.SpanScheduleDelay),
 	)
+	exportProcessor = &queueTrackingProcessor{SpanProcessor: exportProcessor, t: queue}
+
+	// Keep attributes that are only useful locally out of exports
+	if len(cfg.StripSpanAttributes) > 0 {
+		exportProcessor = newStripProcessor(exportProcessor, cfg.StripSpanAttributes)
+	}
+
+	// Cut long attribute values, after scrubbing saw them whole, and say so
+	if cfg.SpanAttributeMaxLength > 0 {
+		exportProcessor = newTruncateProcessor(exportProcessor, cfg.SpanAttributeMaxLength)
+	}
+
+	// Redact PII from attributes before they reach the exporter
+	if scrub != nil {
+		exportProcessor = newScrubProcessor(exportProcessor, scrub)
+	}
+
+	// Export error traces right away instead of at the next batch timeout
+	if cfg.FlushOnError {
+		exportProcessor = newFlushOnErrorProcessor(exportProcessor)
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(exportProcessor),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+	for _, p := range processors {
+		opts = append(opts, sdktrace.WithSpanProcessor(p))
+	}
+	if cfg.IDGenerator != nil {
+		opts = append(opts, sdktrace.WithIDGenerator(cfg.IDGenerator))
+	}
+
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+func initMeter(ctx context.Context, cfg Config, res *resource.Resource, target *otlpTarget, readers []sdkmetric.Reader, views ...sdkmetric.View) (*sdkmetric.MeterProvider, error) {
+	mp, err := newMeterProvider(ctx, res, target, cfg.MetricInterval, readers, views...)
 	if err != nil {
 		return nil, err
 	}
-
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(
-			sdkmetric.NewPeriodicReader(metricExp,
-				sdkmetric.WithInterval(1*time.Second),
-			),
-		),
-		sdkmetric.WithResource(res),
-	)
 	otel.SetMeterProvider(mp)
 	return mp, nil
 }
 
-func initLogger() *zap.Logger {
+// newMeterProvider builds a meter provider exporting to target every
+// interval and applying views to its instruments. Any additional readers,
+// which must not be shared with another provider, also collect from it; with
+// a nil target they are the only ones. It does not install it globally. On
+// error, the exporters it already created are shut down, as in
+// newTracerProvider.
+func newMeterProvider(ctx context.Context, res *resource.Resource, target *otlpTarget, interval time.Duration, readers []sdkmetric.Reader, views ...sdkmetric.View) (*sdkmetric.MeterProvider, error) {
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(views...),
+	}
+	for _, r := range readers {
+		opts = append(opts, sdkmetric.WithReader(r))
+	}
+	if target == nil {
+		return sdkmetric.NewMeterProvider(opts...), nil
+	}
+
+	metricExp, err := newTargetMetricExporter(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, sdkmetric.WithReader(
+		sdkmetric.NewPeriodicReader(metricExp,
+			sdkmetric.WithInterval(interval),
+		),
+	))
+	return sdkmetric.NewMeterProvider(opts...), nil
+}
+
+// shutdownMeterProvider exports whatever mp recorded since its last
+// periodic collection, then shuts it down. Shutdown alone may not pick up
+// the final increments.
+func shutdownMeterProvider(ctx context.Context, mp *sdkmetric.MeterProvider) error {
+	return multierr.Combine(mp.ForceFlush(ctx), mp.Shutdown(ctx))
+}
+
+// prometheusHandler serves the metrics gathered by g for a Prometheus
+// scrape. Exemplars only exist in the OpenMetrics format, which is served to
+// scrapers that ask for it, as Prometheus does with exemplar storage on.
+func prometheusHandler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// initLogger builds the stdout logger. When logs is set, entries are also
+// exported through it, after the same sampling and scrubbing.
+func initLogger(cfg Config, scrub *scrubber, logs *loggerProvider) *zap.Logger {
 	// Create Zap logger configuration
 	config := zap.NewProductionConfig()
+	// Levels are applied per named logger by the outermost core
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 	config.EncoderConfig.TimeKey = "timestamp"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.EncoderConfig.EncodeTime = logTimeEncoder(cfg.Logging.TimeFormat)
+
+	var opts []zap.Option
+	if logs != nil {
+		// Innermost, so the cores below wrap both outputs
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, newOTLPLogCore(core, logs))
+		}), zap.WithFatalHook(fatalFlushHook{logs: logs}))
+	}
+	if cfg.Logging.TraceAffinity {
+		// Sample logs ourselves so sampled traces keep all their logs
+		config.Sampling = nil
+		opts = append(opts, zap.WrapCore(newAffinityCore))
+	}
+	if cfg.CaptureCodeLocation {
+		opts = append(opts, zap.WrapCore(newCodeLocationCore))
+	}
+	if scrub != nil {
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newScrubCore(core, scrub)
+		}))
+	}
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newNamedLevelCore(core, namedLoggers)
+	}))
 
 	// Create logger
-	logger, err := config.Build()
+	logger, err := config.Build(opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -98,15 +254,148 @@ func initLogger() *zap.Logger {
 	return logger
 }
 
-func handleRequest(w http.ResponseWriter, r *http.Request) {
+// logTimeEncoders are the supported LOG_TIME_FORMAT values.
+var logTimeEncoders = map[string]zapcore.TimeEncoder{
+	"iso8601":     zapcore.ISO8601TimeEncoder,
+	"rfc3339nano": zapcore.RFC3339NanoTimeEncoder,
+	"epoch":       zapcore.EpochTimeEncoder,
+	"epoch_nanos": zapcore.EpochNanosTimeEncoder,
+}
+
+// logTimeEncoder returns the timestamp encoder for format, falling back to
+// ISO8601 when it is unset or unknown.
+func logTimeEncoder(format string) zapcore.TimeEncoder {
+	if enc, ok := logTimeEncoders[strings.ToLower(format)]; ok {
+		return enc
+	}
+	return zapcore.ISO8601TimeEncoder
+}
+
+// syncLogger flushes logger. A failure can't be reported through the logger
+// itself, so it goes straight to stderr, is recorded on a logger.Sync span
+// and is counted in log.sync.failures.total. Syncing a terminal or pipe fails with EINVAL or
+// ENOTTY on some platforms; those errors are expected and ignored.
+func syncLogger(ctx context.Context, logger *zap.Logger) {
+	err := logger.Sync()
+	if err == nil {
+		return
+	}
+
+	var genuine []error
+	for _, e := range multierr.Errors(err) {
+		if errors.Is(e, syscall.EINVAL) || errors.Is(e, syscall.ENOTTY) {
+			continue
+		}
+		genuine = append(genuine, e)
+	}
+	if len(genuine) == 0 {
+		return
+	}
+
+	syncErr := multierr.Combine(genuine...)
+	fmt.Fprintf(os.Stderr, "failed to sync logger: %v\n", syncErr)
+
+	_, span := otel.Tracer("go-sample-app").Start(ctx, "logger.Sync")
+	span.RecordError(syncErr)
+	span.SetStatus(codes.Error, "logger sync failed")
+	span.End()
+
+	failures, err := appMeter("go-sample-app/logger").Int64Counter(
+		"log.sync.failures.total",
+		metric.WithDescription("Number of failed logger syncs"),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create log sync failure counter: %v\n", err)
+		return
+	}
+	failures.Add(ctx, 1)
+}
+
+// requestMetrics are the instruments /hello records into. They are created
+// once per meter provider so the handler only records.
+type requestMetrics struct {
+	requests   metric.Int64Counter
+	gcOccurred metric.Int64Counter
+	duration   metric.Float64Histogram
+	iterations metric.Int64Histogram
+	heapPeak   metric.Int64Histogram
+}
+
+func newRequestMetrics(meter metric.Meter) (*requestMetrics, error) {
+	requests, err := meter.Int64Counter(
+		"http.requests.total",
+		metric.WithDescription("Total number of HTTP requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	gcOccurred, err := meter.Int64Counter(
+		"work.gc_occurred.total",
+		metric.WithDescription("Number of requests during whose work loop at least one GC cycle completed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram(
+		"http.request.duration",
+		metric.WithDescription("HTTP request duration"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := meter.Int64Histogram(
+		"work.iterations",
+		metric.WithDescription("Number of work loop iterations a request performed"),
+		metric.WithExplicitBucketBoundaries(0, 10, 25, 50, 75, 90, 100, 250, 1000, 10000, 100000),
+	)
+	if err != nil {
+		return nil, err
+	}
+	heapPeak, err := meter.Int64Histogram(
+		"work.heap.peak_growth",
+		metric.WithDescription("Peak heap growth above its size at the start of a request's work loop"),
+		metric.WithUnit("By"),
+		// 256 KiB to 64 MiB; the default buckets are sized for milliseconds
+		metric.WithExplicitBucketBoundaries(1<<18, 1<<19, 1<<20, 1<<21, 1<<22, 1<<23, 1<<24, 1<<25, 1<<26),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &requestMetrics{
+		requests:   requests,
+		gcOccurred: gcOccurred,
+		duration:   duration,
+		iterations: iterations,
+		heapPeak:   heapPeak,
+	}, nil
+}
+
+// helloHandler serves /hello, recording into metrics unless the request
+// belongs to a tenant with its own. It expects to run inside the server span
+// newServerHandler starts.
+type helloHandler struct {
+	cfg     Config
+	metrics *requestMetrics
+}
+
+func newHelloHandler(cfg Config, metrics *requestMetrics) http.Handler {
+	return &helloHandler{cfg: cfg, metrics: metrics}
+}
+
+func (h *helloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The server span is started by otelhttp, see newServerHandler
 	ctx := r.Context()
-	tracer := otel.Tracer("go-sample-app")
-	ctx, span := tracer.Start(ctx, "handleRequest")
-	defer span.End()
+	tracer := tracerProvider(ctx).Tracer("go-sample-app")
+	span := serverSpan(ctx, "handleRequest")
+
+	span.SetAttributes(retryAttrs(ctx)...)
+
+	rw := newResponseRecorder(w)
 
 	// Add trace ID to pprof labels
 	traceID := span.SpanContext().TraceID().String()
-	labels := pprof.Labels("trace_id", traceID)
+	labels := requestProfileLabels(traceID)
 
 	// Set labels for the main goroutine
 	ctx = pprof.WithLabels(ctx, labels)
@@ -114,123 +403,788 @@ func handleRequest(w http.ResponseWriter, r *http.Request) {
 	defer pprof.SetGoroutineLabels(context.Background())
 
 	startTime := time.Now()
-	logger := zap.L()
+	// trace_sampled tells a missing trace that was sampled out from a lost one
+	logger := zap.L().Named(loggerHTTP).With(
+		zap.Bool("trace_sampled", span.SpanContext().IsSampled()),
+		spanContextField(span.SpanContext()),
+	)
+	if span.SpanContext().IsSampled() {
+		logger = logger.With(sampledTraceField())
+	}
 
 	// Log request with trace ID
 	logger.Info("handling request",
 		zap.String("path", r.URL.Path),
 		zap.String("method", r.Method),
 		zap.String("remote_addr", r.RemoteAddr),
-		zap.String("trace_id", traceID),
+		traceIDField(span.SpanContext()),
 	)
 
-	// Simulate CPU-intensive work
-	for i := 0; i < 100; i++ {
-		_ = make([]byte, 1024*1024) // Allocate more memory
-		time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
-	}
-
-	// Get trace ID from span context
-	traceID = span.SpanContext().TraceID().String()
-
 	// Create attributes for metrics
 	attrs := []attribute.KeyValue{
 		attribute.String("path", r.URL.Path),
 		attribute.String("method", r.Method),
 		attribute.String("trace_id", traceID),
 	}
+	attrs = append(attrs, requestDynamicAttrs.Attributes()...)
 
-	// Record metrics (trace ID will be automatically used as exemplar)
-	meter := otel.Meter("http-server")
-	requestCounter, err := meter.Int64Counter(
-		"http.requests.total",
-		metric.WithDescription("Total number of HTTP requests"),
-	)
+	// Count every request, including those rejected below
+	metrics := requestMetricsFor(ctx, h.metrics)
+	metrics.requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	// Shape the simulated work from the query params
+	workload, err := parseWorkloadParams(r.URL.Query())
 	if err != nil {
-		logger.Fatal("failed to create request counter", zap.Error(err))
+		writeError(rw, span, errValidation, http.StatusBadRequest, err.Error())
+		return
 	}
-	requestCounter.Add(ctx, 1, metric.WithAttributes(attrs...))
+	span.SetAttributes(workload.attributes()...)
 
-	duration := float64(time.Since(startTime).Milliseconds())
-	requestDuration, err := meter.Float64Histogram(
-		"http.request.duration",
-		metric.WithDescription("HTTP request duration"),
-		metric.WithUnit("ms"),
-	)
-	if err != nil {
-		logger.Fatal("failed to create request duration histogram", zap.Error(err))
+	// Apply per-request feature flags
+	flags := featureFlagsFromContext(ctx)
+	if len(flags) > 0 {
+		span.SetAttributes(attribute.StringSlice("feature_flags", flags.List()))
+	}
+	if flags.Enabled(flagExtraAttributes) {
+		span.SetAttributes(
+			semconv.UserAgentOriginal(r.UserAgent()),
+			attribute.String("client.address", r.RemoteAddr),
+			attribute.Int64("http.request.body.size", r.ContentLength),
+		)
+	}
+	verbose := flags.Enabled(flagVerboseLogging)
+	if verbose {
+		fields := []zap.Field{
+			zap.String("query", r.URL.RawQuery),
+			traceIDField(span.SpanContext()),
+			zap.Namespace("headers"),
+		}
+		for name, values := range r.Header {
+			value := strings.Join(values, ",")
+			if sensitiveHeaders[name] {
+				value = redacted
+			}
+			fields = append(fields, zap.String(name, value))
+		}
+		logger.Info("request details", fields...)
 	}
-	requestDuration.Record(ctx, duration, metric.WithAttributes(attrs...))
 
-	// Log response
-	logger.Info("request completed",
-		zap.String("path", r.URL.Path),
-		zap.String("method", r.Method),
-		zap.Float64("duration_ms", duration),
-		zap.Int("status", http.StatusOK),
+	// Profile the heap around requests that turn out to allocate a lot. Only
+	// sampled ones, as the profiles are found through their span.
+	var capture *heapCapture
+	if requestHeapProfiles != nil && span.SpanContext().IsSampled() {
+		if capture, err = requestHeapProfiles.start(); err != nil {
+			logger.Warn("failed to capture heap profile", zap.Error(err))
+		}
+	}
+
+	// Simulate CPU-intensive work
+	gcBefore := gcCycles()
+	heap := newHeapPeak()
+	var iterations int
+	span.AddEvent("workload.start")
+	profileRegion(ctx, tracer, "work", h.cfg.PprofRegionSpans, func(ctx context.Context) {
+		for i := 0; i < workload.iterations && ctx.Err() == nil; i++ {
+			iterations++
+			_ = make([]byte, workload.allocKB*1024) // Allocate more memory
+			heap.sample()
+			workload.sleep()
+			if verbose && (i+1)%25 == 0 {
+				logger.Info("workload progress",
+					zap.Int("iteration", i+1),
+					traceIDField(span.SpanContext()),
+				)
+			}
+		}
+	})
+	span.AddEvent("workload.end", trace.WithAttributes(attribute.Int("work.iterations", iterations)))
+	if capture != nil {
+		if err := requestHeapProfiles.finish(capture, span, logger); err != nil {
+			logger.Warn("failed to save heap profiles", zap.Error(err))
+		}
+	}
+
+	gcDuring := gcCycles() - gcBefore
+	span.SetAttributes(
+		attribute.Bool("work.gc_occurred", gcDuring > 0),
+		attribute.Int64("work.gc_cycles", int64(gcDuring)),
+		attribute.Int("work.iterations", iterations),
+		attribute.Int64("work.heap.peak_growth", heap.growth()),
 	)
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Hello, World!"))
+	// Simulate waiting on an external dependency
+	if h.cfg.SimulatedWait > 0 {
+		profileRegion(ctx, tracer, "wait", h.cfg.PprofRegionSpans, func(ctx context.Context) {
+			simulateExternalWait(ctx, tracer, h.cfg.SimulatedWait, h.cfg.PeerServices)
+		})
+	}
+
+	// Continue the trace into the downstream service, if there is one
+	var downstreamErr error
+	if h.cfg.DownstreamURL != "" {
+		downstreamErr = callDownstream(ctx, h.cfg.DownstreamURL, h.cfg.RequestTimeoutHeader)
+	}
+
+	// Finish up in the background, in a trace linked to this one
+	if flags.Enabled(flagAsyncWork) {
+		simulateAsyncFollowUp(ctx)
+	}
+
+	// Emit a log at a randomly drawn level for a realistic level mix
+	if len(h.cfg.LogLevelMix) > 0 {
+		emitDemoLog(logger, h.cfg.LogLevelMix, traceIDField(span.SpanContext()))
+	}
+
+	// Record metrics. The sampled span in ctx becomes the exemplar, under the
+	// default trace_based filter.
+	if gcDuring > 0 {
+		metrics.gcOccurred.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	metrics.iterations.Record(ctx, int64(iterations), metric.WithAttributes(attrs...))
+	metrics.heapPeak.Record(ctx, heap.growth(), metric.WithAttributes(attrs...))
+
+	// Record the duration once the response has been written, so the outcome
+	// reflects what the client actually got.
+	defer func() {
+		duration := float64(time.Since(startTime).Milliseconds())
+		outcome := requestOutcome(ctx, rw)
+		if outcome != outcomeSuccess {
+			span.SetAttributes(capturedBodyAttrs(ctx)...)
+		}
+		// Timed out requests are recorded like the others, and keep their
+		// exemplar if slow enough to get one
+		if h.cfg.DurationDetail.RecordHistogram(routePattern(ctx)) {
+			recordCtx := exemplarContext(ctx, time.Since(startTime), h.cfg.SlowExemplarThreshold)
+			metrics.duration.Record(recordCtx, duration, metric.WithAttributes(
+				append(attrs, attribute.String("outcome", outcome))...,
+			))
+			if requestDurationWindow != nil {
+				requestDurationWindow.record(duration)
+			}
+		}
+
+		// Log response
+		logger.Info("request completed",
+			zap.String("path", r.URL.Path),
+			zap.String("method", r.Method),
+			zap.Float64("duration_ms", duration),
+			zap.Int("status", rw.Status()),
+			zap.String("outcome", outcome),
+		)
+	}()
+
+	// The work stops early once the request deadline has passed
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		writeError(rw, span, errTimeout, http.StatusGatewayTimeout, "request deadline exceeded")
+		return
+	}
+
+	// A failed dependency fails the request
+	if downstreamErr != nil {
+		writeError(rw, span, errUpstream, http.StatusBadGateway, downstreamErr.Error())
+		return
+	}
+
+	// Fail a share of requests on purpose to demo error traces
+	if h.cfg.SimulatedErrorRate > 0 && rand.Float64() < h.cfg.SimulatedErrorRate {
+		err := errors.New("simulated workload failure")
+		span.RecordError(err)
+		writeError(rw, span, errInternal, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.WriteHeader(http.StatusOK)
+	if _, err := rw.Write([]byte("Hello, World!")); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to write response")
+	}
 }
 
 func main() {
 	ctx := context.Background()
 
+	// Set when shutdown fails. Deferred first, so the exit happens after
+	// every other deferred cleanup has run.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// Bounds the drain and the provider flushes together. Replaced by a
+	// SHUTDOWN_TIMEOUT deadline once serving stops, and cancelled after
+	// every deferred flush has run.
+	shutdownCtx, cancelShutdown := ctx, context.CancelFunc(func() {})
+	defer func() { cancelShutdown() }()
+
+	// Logs startup failures until the configured logger is built
+	bootLogger := zap.Must(zap.NewProduction())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		bootLogger.Fatal("failed to load configuration", zap.Error(err))
+	}
+	otlpTLS, err := newOTLPTLSConfig(cfg.OTLPInsecure, cfg.OTLPCAFile)
+	if err != nil {
+		bootLogger.Fatal("failed to load OTLP TLS configuration", zap.Error(err))
+	}
+
 	// Enable profiling with higher sampling rates
 	runtime.SetMutexProfileFraction(1)
 	runtime.SetBlockProfileRate(1)
 	runtime.SetCPUProfileRate(100)
 
-	// Start profiling server
-	go func() {
-		// If you're using Pyroscope Go SDK, initialize pyroscope profiler.
-		_, _ = pyroscope.Start(pyroscope.Config{
-			ApplicationName: "my-go-app",
-			ServerAddress:   "http://localhost:4040",
-		})
-	}()
+	// Secret files take precedence over OTEL_COLLECTOR_ENDPOINT and
+	// OTEL_EXPORTER_OTLP_HEADERS, and are re-read on SIGHUP
+	secrets := otlpSecretFiles{
+		endpointFile:    cfg.OTLPEndpointFile,
+		headersFile:     cfg.OTLPHeadersFile,
+		defaultEndpoint: cfg.OTLPEndpoint,
+		defaultHeaders:  cfg.OTLPHeaders,
+	}
+	otelCollector, otlpHeaders, err := secrets.load()
+	if err != nil {
+		bootLogger.Fatal("failed to read OTLP secret files", zap.Error(err))
+	}
+	target := newOTLPTarget(cfg.OTLPProtocol, otlpTLS, otelCollector, otlpHeaders)
+	target.failures.ready = &telemetryReady
+
+	// Build the PII scrubber shared by logs and spans
+	var scrub *scrubber
+	if cfg.Scrub {
+		s, err := newScrubber(cfg.ScrubPatterns)
+		if err != nil {
+			bootLogger.Fatal("failed to initialize scrubber", zap.Error(err))
+		}
+		scrub = s
+	}
 
-	otelCollector := os.Getenv("OTEL_COLLECTOR_ENDPOINT")
-	if otelCollector == "" {
-		otelCollector = "localhost:4318"
+	// Describe this service once for every signal
+	res, err := newResource(ctx, cfg)
+	if errors.Is(err, resource.ErrPartialResource) {
+		bootLogger.Warn("some resource attributes could not be detected", zap.Error(err))
+	} else if err != nil {
+		bootLogger.Fatal("failed to create resource", zap.Error(err))
+	}
+
+	// Export logs over OTLP as well as to stdout
+	var logs *loggerProvider
+	if cfg.Logging.OTLP {
+		logs = initLoggerProvider(res, target, cfg.Logging.OTLPMinLevel)
+		defer func() {
+			if err := logs.Shutdown(shutdownCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to shut down logger provider: %v\n", err)
+				exitCode = 1
+			}
+		}()
 	}
 
 	// Initialize logger
-	logger := initLogger()
-	defer logger.Sync()
+	namedLoggers = newLoggerLevels(cfg.Logging.Level)
+	if err := namedLoggers.parse(cfg.Logging.Levels); err != nil {
+		bootLogger.Fatal("invalid LOG_LEVELS", zap.Error(err))
+	}
+	logger := initLogger(cfg, scrub, logs)
 
 	// Replace global logger
 	zap.ReplaceGlobals(logger)
+	secrets.reloadOnSIGHUP(target)
 
-	// Initialize tracer provider
-	tp, err := initTracer(ctx, otelCollector)
+	// Retry provider setup a few times rather than crash-looping while the
+	// collector comes up
+	retry := startupRetry{
+		attempts:  cfg.StartupRetryAttempts,
+		baseDelay: cfg.StartupRetryBaseDelay,
+	}
+
+	// Optionally hold startup until the collector accepts connections. On
+	// timeout a strict wait stops the app, otherwise it starts anyway.
+	if cfg.WaitForCollector {
+		collector := tcpDependency("collector", target.Endpoint, true)
+		if err := waitFor(ctx, logger, collector, cfg.WaitForCollectorTimeout); err != nil {
+			if cfg.WaitForCollectorStrict {
+				logger.Fatal("collector not reachable", zap.Error(err))
+			}
+			logger.Warn("collector not reachable, starting anyway", zap.Error(err))
+		}
+	}
+
+	// A missing socket would only show up as failing exports
+	if path, ok := unixSocketPath(target.Endpoint()); ok {
+		if err := checkUnixSocket(path); err != nil {
+			logger.Fatal("OTLP collector socket not usable; is the node-local collector running and the socket mounted?", zap.String("socket", path), zap.Error(err))
+		}
+	}
+
+	// Apply configured instrument descriptions and units
+	views := cfg.MetricViews
+	if keys := cfg.StripMetricAttributes; len(keys) > 0 {
+		views = []sdkmetric.View{stripAttributesView(keys, views...)}
+	}
+
+	// Let the debug endpoints collect metrics on demand
+	var readers []sdkmetric.Reader
+	var snapshotReader *sdkmetric.ManualReader
+	if cfg.DebugEndpoints {
+		snapshotReader = sdkmetric.NewManualReader()
+		readers = append(readers, snapshotReader)
+	}
+
+	// Expose metrics for Prometheus to scrape instead of pushing them
+	metricsTarget := target
+	var promRegistry *prometheus.Registry
+	if cfg.MetricsExporter == metricsExporterPrometheus {
+		promRegistry = prometheus.NewRegistry()
+		promExp, err := otelprometheus.New(otelprometheus.WithRegisterer(promRegistry))
+		if err != nil {
+			logger.Fatal("failed to create Prometheus exporter", zap.Error(err))
+		}
+		readers = append(readers, promExp)
+		metricsTarget = nil
+	}
+
+	// Initialize meter provider
+	var mp *sdkmetric.MeterProvider
+	err = retry.do(logger, "meter provider", func() (err error) {
+		mp, err = initMeter(ctx, cfg, res, metricsTarget, readers, views...)
+		return err
+	})
 	if err != nil {
-		panic("failed to initialize tracer provider: " + err.Error())
+		logger.Fatal("failed to initialize meter provider", zap.Error(err))
 	}
 	defer func() {
-		if err := tp.Shutdown(ctx); err != nil {
-			logger.Error("Error shutting down tracer provider", zap.Error(err))
+		if err := shutdownMeterProvider(shutdownCtx, mp); err != nil {
+			logger.Error("Error shutting down meter provider", zap.Error(err))
+			exitCode = 1
 		}
 	}()
 
-	// Initialize meter provider
-	mp, err := initMeter(ctx, otelCollector)
+	// Create the high-frequency instruments on a provider of their own, whose
+	// faster reader collects nothing else. Instruments created earlier stay
+	// where they are, so this comes before any is created.
+	if len(cfg.HighFrequencyMetrics) > 0 && metricsTarget != nil {
+		fastMP, err := newHighFrequencyMeterProvider(ctx, res, metricsTarget, cfg.HighFrequencyInterval, views...)
+		if err != nil {
+			logger.Fatal("failed to initialize high-frequency meter provider", zap.Error(err))
+		}
+		defer func() {
+			if err := shutdownMeterProvider(shutdownCtx, fastMP); err != nil {
+				logger.Error("Error shutting down high-frequency meter provider", zap.Error(err))
+				exitCode = 1
+			}
+		}()
+		instruments.routeHighFrequency(mp, fastMP, cfg.HighFrequencyMetrics)
+	}
+
+	// Report SDK errors through the logger
+	if err := initErrorHandler(logger.Named(loggerOTel)); err != nil {
+		logger.Fatal("failed to set OTel error handler", zap.Error(err))
+	}
+
+	// Exemplars are still experimental in the Go SDK, which only records them
+	// when OTEL_GO_X_EXEMPLAR is true. The Docker image sets it.
+	if !strings.EqualFold(os.Getenv("OTEL_GO_X_EXEMPLAR"), "true") {
+		logger.Info("exemplars are off; set OTEL_GO_X_EXEMPLAR=true to record them")
+	}
+
+	// What is in effect, after defaults, for checking tuning changes
+	logger.Info("telemetry export configuration",
+		zap.String("otlp_protocol", cfg.OTLPProtocol),
+		zap.String("otlp_endpoint", cfg.OTLPEndpoint),
+		zap.String("metrics_exporter", cfg.MetricsExporter),
+		zap.Duration("metric_export_interval", cfg.MetricInterval),
+		zap.Int("span_queue_size", cfg.SpanQueueSize),
+		zap.Int("span_batch_size", cfg.SpanBatchSize),
+		zap.Duration("span_schedule_delay", cfg.SpanScheduleDelay),
+	)
+
+	// Push continuous profiles to Pyroscope. Profiling is best effort, so a
+	// failure to start it doesn't stop the app.
+	if cfg.Pyroscope {
+		profiler, err := startProfiler(cfg)
+		if err != nil {
+			logger.Warn("failed to start pyroscope profiler",
+				zap.String("server_address", cfg.PyroscopeAddr),
+				zap.Error(err),
+			)
+		} else {
+			defer func() {
+				if err := profiler.Stop(); err != nil {
+					logger.Error("Error stopping pyroscope profiler", zap.Error(err))
+				}
+			}()
+		}
+	}
+
+	// Track how close spans get to the attribute limit
+	attrCounts, err := newAttrCountProcessor()
 	if err != nil {
-		panic("failed to initialize meter provider: " + err.Error())
+		logger.Fatal("failed to create attribute count processor", zap.Error(err))
+	}
+	processors := []sdktrace.SpanProcessor{attrCounts}
+	if cfg.CaptureCodeLocation {
+		processors = append(processors, codeLocationProcessor{})
+	}
+
+	// Latency metrics for every span, without per-handler instrumentation
+	if cfg.SpanDurationMetrics {
+		spanDurations, err := newSpanDurationProcessor()
+		if err != nil {
+			logger.Fatal("failed to create span duration processor", zap.Error(err))
+		}
+		processors = append(processors, spanDurations)
+	}
+
+	// Attributes that can change without a restart, reloaded on SIGHUP
+	if path := cfg.DynamicAttributesFile; path != "" {
+		requestDynamicAttrs = newDynamicAttributes()
+		if err := requestDynamicAttrs.Load(path); err != nil {
+			logger.Fatal("failed to load dynamic attributes", zap.Error(err))
+		}
+		requestDynamicAttrs.reloadOnSIGHUP(path)
+		processors = append(processors, &dynamicAttrProcessor{attrs: requestDynamicAttrs})
+	}
+
+	// Keep recent spans in memory for the debug endpoints
+	var recorder *spanRecorder
+	if cfg.DebugEndpoints {
+		recorder = newSpanRecorder(cfg.RecorderMaxTraces, cfg.RecorderMaxBytes)
+		if err := recorder.registerTraceCountGauge(); err != nil {
+			logger.Fatal("failed to register recorder gauge", zap.Error(err))
+		}
+		processors = append(processors, recorder)
+	}
+
+	// Build the sampler shared by all tracer providers
+	sampler, err := parseTraceSampler(cfg.Sampling.Sampler, cfg.Sampling.SamplerArg)
+	if err != nil {
+		logger.Fatal("invalid OTEL_TRACES_SAMPLER", zap.Error(err))
+	}
+	if cfg.Sampling.Adaptive {
+		adaptive, err := newAdaptiveSampler(cfg.Sampling.AdaptiveThreshold, cfg.Sampling.AdaptiveMinRatio)
+		if err != nil {
+			logger.Fatal("failed to configure adaptive sampling", zap.Error(err))
+		}
+		if err := adaptive.registerRatioGauge(); err != nil {
+			logger.Fatal("failed to register sampling ratio gauge", zap.Error(err))
+		}
+		sampler = sdktrace.ParentBased(adaptive)
+	}
+	if cfg.Sampling.Consistent {
+		// Not parent-based: every hop reaches the same decision on its own
+		sampler, err = newConsistentSampler(cfg.Sampling.ConsistentRatio)
+		if err != nil {
+			logger.Fatal("failed to configure consistent sampling", zap.Error(err))
+		}
+	}
+	if v := cfg.Sampling.ByMethod; v != "" {
+		sampler, err = newMethodSampler(sampler, v)
+		if err != nil {
+			logger.Fatal("invalid SAMPLING_RATIO_BY_METHOD", zap.Error(err))
+		}
+	}
+	sampler = newForceSampleSampler(sampler, cfg.Sampling.ForcePerSecond)
+	if entry := cfg.Sampling.TracestateEntry; entry != "" {
+		sampler, err = newTracestateSampler(sampler, entry)
+		if err != nil {
+			logger.Fatal("failed to configure tracestate entry", zap.Error(err))
+		}
+	}
+	sampler, err = newCountingSampler(sampler)
+	if err != nil {
+		logger.Fatal("failed to create sampler", zap.Error(err))
+	}
+	if err := registerSamplingOverrideCounter(appMeter("go-sample-app/sampler")); err != nil {
+		logger.Fatal("failed to register sampling override counter", zap.Error(err))
+	}
+
+	// Initialize tracer provider
+	var tp *sdktrace.TracerProvider
+	spanQueue := newSpanQueueTracker()
+	err = retry.do(logger, "tracer provider", func() (err error) {
+		tp, err = initTracer(ctx, cfg, res, target, sampler, scrub, spanQueue, processors...)
+		return err
+	})
+	if err != nil {
+		logger.Fatal("failed to initialize tracer provider", zap.Error(err))
 	}
 	defer func() {
-		if err := mp.Shutdown(ctx); err != nil {
-			logger.Error("Error shutting down meter provider", zap.Error(err))
+		if err := tp.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error shutting down tracer provider", zap.Error(err))
+			exitCode = 1
 		}
 	}()
 
-	http.HandleFunc("/hello", handleRequest)
+	// Go runtime metrics (heap, GC pauses, goroutines) through the same
+	// pipeline. They are observed at every collection, requests or not, and
+	// stop with the meter provider.
+	if cfg.RuntimeMetrics {
+		err := otelruntime.Start(
+			otelruntime.WithMeterProvider(mp),
+			otelruntime.WithMinimumReadMemStatsInterval(cfg.RuntimeMetricsInterval),
+		)
+		if err != nil {
+			logger.Fatal("failed to start runtime metrics", zap.Error(err))
+		}
+	}
+
+	// Telemetry is ready once something gets through: an export, or failing
+	// that a connection to the collector
+	readyCtx, stopReadyCheck := context.WithCancel(ctx)
+	defer stopReadyCheck()
+	go setWhenUp(readyCtx, &telemetryReady, tcpDependency("collector", target.Endpoint, true))
+
+	// Runs before the providers shut down so a sync failure is still exported
+	defer func() { syncLogger(shutdownCtx, logger) }()
+
+	// Watch for spans backing up before export
+	if err := spanQueue.registerInstruments(appMeter("go-sample-app/trace")); err != nil {
+		logger.Fatal("failed to register span queue instruments", zap.Error(err))
+	}
+
+	// Alert on sustained export failures rather than single blips
+	if err := target.failures.registerGauge(appMeter("go-sample-app/exporter")); err != nil {
+		logger.Fatal("failed to register export failure gauge", zap.Error(err))
+	}
+
+	// Count gRPC exporters reconnecting to the collector
+	if err := registerReconnectCounter(appMeter("go-sample-app/exporter")); err != nil {
+		logger.Fatal("failed to register exporter reconnect counter", zap.Error(err))
+	}
+
+	// Watch the cardinality of the trace_id pprof labels
+	if err := registerPprofLabelGauge(appMeter("go-sample-app/pprof")); err != nil {
+		logger.Fatal("failed to register pprof label gauge", zap.Error(err))
+	}
+
+	// Count error responses by application error code
+	if err := registerErrorCounter(appMeter("go-sample-app/http")); err != nil {
+		logger.Fatal("failed to register error counter", zap.Error(err))
+	}
+
+	// Generate synthetic traces instead of serving HTTP
+	if cfg.LoadGen.Enabled {
+		gen := newLoadGenerator(
+			cfg.LoadGen.TracesPerSecond,
+			cfg.LoadGen.SpansPerTrace,
+			cfg.LoadGen.Depth,
+			cfg.LoadGen.AttributeSize,
+		)
+		if err := gen.registerRateGauge(); err != nil {
+			logger.Fatal("failed to register load generator gauge", zap.Error(err))
+		}
+		warnUnroutedHighFrequency(logger)
+		loadCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		gen.run(loadCtx)
+		// The deferred provider shutdowns flush the last traces within the
+		// same deadline as when serving
+		shutdownCtx, cancelShutdown = context.WithTimeout(ctx, cfg.ShutdownTimeout)
+		return
+	}
+
+	// Only a warning, since the level can be lowered at runtime
+	for _, lp := range cfg.LogLevelMix {
+		if lvl := namedLoggers.levelFor(loggerHTTP); lp.level < lvl {
+			logger.Warn("LOG_LEVEL_PROBABILITIES draws a level the http logger drops",
+				zap.Stringer("drawn_level", lp.level),
+				zap.Stringer("logger_level", lvl),
+			)
+		}
+	}
+	if threshold := cfg.HeapProfile.AllocThreshold; threshold > 0 {
+		requestHeapProfiles, err = newHeapProfiler(uint64(threshold), cfg.HeapProfile.Dir, cfg.HeapProfile.MaxSaved)
+		if err != nil {
+			logger.Fatal("failed to set up request heap profiles", zap.Error(err))
+		}
+	}
+	if window := cfg.DurationQuantilesWindow; window > 0 {
+		requestDurationWindow = newSlidingWindow(window)
+		if err := requestDurationWindow.registerGauge(appMeter("http-server")); err != nil {
+			logger.Fatal("failed to register duration quantile gauge", zap.Error(err))
+		}
+	}
+
+	metrics, err := newRequestMetrics(appMeter("http-server"))
+	if err != nil {
+		logger.Fatal("failed to create request metrics", zap.Error(err))
+	}
+	hello := newHelloHandler(cfg, metrics)
+	var tenants *tenantRegistry
+	if cfg.Tenant.Enabled {
+		// Route each tenant's telemetry to its own providers
+		tenants = newTenantRegistry(res, target, sampler, scrub, processors, views, cfg)
+		go tenants.run(ctx)
+		defer func() { tenants.Shutdown(shutdownCtx) }()
+	}
+
+	// Bound concurrent /hello requests. Inside the server span, so requests
+	// shed while waiting are traced and counted by otelhttp too.
+	if limit := cfg.MaxConcurrentRequests; limit > 0 {
+		limiter, err := newConcurrencyLimiter(appMeter("go-sample-app/http"), limit)
+		if err != nil {
+			logger.Fatal("failed to create concurrency limiter", zap.Error(err))
+		}
+		hello = limiter.Wrap(hello)
+	}
+
+	// Recognize client retries by their Idempotency-Key
+	retries, err := appMeter("http-server").Int64Counter(
+		"http.requests.retries.total",
+		metric.WithDescription("Number of requests repeating a recently seen Idempotency-Key"),
+	)
+	if err != nil {
+		logger.Fatal("failed to create retries counter", zap.Error(err))
+	}
+	hello = withRetryDetection(
+		newIdempotencyCache(cfg.IdempotencyWindow, cfg.IdempotencyMaxKeys),
+		retries,
+		hello,
+	)
 
-	logger.Info("Server starting on :8080")
+	cache, err := newCacheDemo(cfg.CacheHitRatio, cfg.PeerServices)
+	if err != nil {
+		logger.Fatal("failed to create cache demo", zap.Error(err))
+	}
+
+	exemplars, err := newExemplarDemo()
+	if err != nil {
+		logger.Fatal("failed to create exemplar demo", zap.Error(err))
+	}
+
+	budget, err := newBudgetDemo()
+	if err != nil {
+		logger.Fatal("failed to create deadline budget demo", zap.Error(err))
+	}
+
+	// Mount every route, including net/http/pprof, under ROUTE_PREFIX
+	mux := http.NewServeMux()
+	routes := newRouter(mux, cfg.RoutePrefix)
+	routes.spanNames = cfg.SpanNames
+	routes.redact = cfg.RedactQueryParams
+
+	// Count the routes exercised so far; the probes are left out
+	routes.served = &routeSet{}
+	if err := routes.served.registerGauge(appMeter("go-sample-app/http")); err != nil {
+		logger.Fatal("failed to register served routes gauge", zap.Error(err))
+	}
+	routes.Handle("/hello", hello)
+	routes.HandleFunc("/cancel-demo", handleCancelDemo)
+	routes.Handle("/cache-demo", cache)
+	routes.Handle("/demo/exemplars", exemplars)
+	routes.Handle("/demo/deadline-budget", budget)
+	routes.Mount("/debug/pprof/", http.DefaultServeMux)
+
+	if cfg.DebugEndpoints {
+		registerDebugHandlers(routes, recorder, snapshotReader, cfg.DebugPropagationHeaders)
+	}
+
+	logger.Info("Server starting on "+cfg.ListenAddr, zap.String("route_prefix", routes.prefix))
+
+	// Trace every route, on the tenant's providers if there is one
+	handler := newServerHandler(mux)
+	if tenants != nil {
+		handler = withTenant(tenants, cfg.Tenant.Header, handler)
+	}
+
+	// Resolve per-request feature flags for every route, before the sampler
+	// sees them
+	handler = withFeatureFlags(cfg.FeatureFlags, cfg.FeatureFlagsHeader, handler)
+
+	// Keep request bodies around for the spans of failed requests
+	if cfg.BodyCapture.Enabled {
+		capture := &bodyCapture{maxBytes: cfg.BodyCapture.MaxBytes}
+		if cfg.BodyCapture.Scrub {
+			capture.scrub, err = newScrubber(cfg.ScrubPatterns)
+			if err != nil {
+				logger.Fatal("failed to create body capture scrubber", zap.Error(err))
+			}
+		}
+		handler = capture.Wrap(handler)
+	}
+
+	// Honor the deadline upstreams propagate with each request
+	handler = withRequestDeadline(cfg.RequestTimeoutHeader, handler)
+
+	// Track how many requests continue a trace from upstream
+	handler, err = withTraceContinuity(appMeter("go-sample-app/http"), handler)
+	if err != nil {
+		logger.Fatal("failed to create trace continuity counter", zap.Error(err))
+	}
+
+	// Log key request counters to the console for local feedback
+	if interval := cfg.ConsoleMetricsInterval; interval > 0 {
+		stats := &consoleStats{}
+		handler = stats.Wrap(handler)
+		done := make(chan struct{})
+		defer close(done)
+		go stats.run(interval, done)
+	}
+
+	// Report readiness based on telemetry setup, the collector and configured
+	// upstreams
+	deps := []dependency{
+		flagDependency("telemetry", &telemetryReady),
+		tcpDependency("collector", target.Endpoint, cfg.Readiness.CollectorCritical),
+	}
+	deps = append(deps, parseReadinessURLs(cfg.Readiness.URLs, cfg.Readiness.Optional)...)
+
+	// Serve the probes on their own mux, ahead of the middleware, so frequent
+	// probing produces no traces or request metrics
+	probes := http.NewServeMux()
+	probeRoutes := newRouter(probes, routes.prefix)
+	probeRoutes.redact = cfg.RedactQueryParams
+	probeRoutes.HandleFunc("/healthz", handleHealthz)
+	probeRoutes.HandleFunc("/readyz", handleReadyz(deps, cfg.Readiness.Timeout))
+	if promRegistry != nil {
+		// Outside the middleware too: scrapes must not be instrumented
+		gatherers := prometheus.Gatherers{promRegistry}
+		if tenants != nil {
+			gatherers = append(gatherers, tenants)
+		}
+		probeRoutes.Handle("/metrics", prometheusHandler(gatherers))
+	}
+	probes.Handle("/", handler)
+
+	// Track connection states alongside the request metrics
+	conns, err := newConnTracker(appMeter("go-sample-app/http"))
+	if err != nil {
+		logger.Fatal("failed to create connection tracker", zap.Error(err))
+	}
+	warnUnroutedHighFrequency(logger)
+
+	srv := &http.Server{
+		Addr:      cfg.ListenAddr,
+		Handler:   probes,
+		ConnState: conns.ConnState,
+	}
+
+	// Serve until interrupted
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	// A serve error falls through to the shutdown rather than exiting, so
+	// the deferred flushes still export the telemetry
+	select {
+	case err := <-serveErr:
+		logger.Error("failed to start server", zap.Error(err))
+		exitCode = 1
+	case <-sigCtx.Done():
+	}
+	// A second signal kills the process right away
+	stop()
 
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		logger.Fatal("failed to start server", zap.Error(err))
+	// Drain in-flight requests; the deferred provider shutdowns then export
+	// the telemetry they produced within what is left of the same deadline
+	logger.Info("shutting down server", zap.Duration("timeout", cfg.ShutdownTimeout))
+	shutdownCtx, cancelShutdown = context.WithTimeout(ctx, cfg.ShutdownTimeout)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to drain in-flight requests", zap.Error(err))
+		exitCode = 1
 	}
 }
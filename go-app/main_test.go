@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testConfig returns a Config with the SDK's batch span processor defaults,
+// for tests that build providers.
+func testConfig() Config {
+	return Config{
+		MetricInterval:    time.Hour,
+		SpanQueueSize:     sdktrace.DefaultMaxQueueSize,
+		SpanBatchSize:     sdktrace.DefaultMaxExportBatchSize,
+		SpanScheduleDelay: sdktrace.DefaultScheduleDelay * time.Millisecond,
+	}
+}
+
+// useTestTracerProvider makes a sampling tracer provider the global one for
+// the test and returns the recorder its spans end up in.
+func useTestTracerProvider(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestHelloDurationExemplarHasTraceID(t *testing.T) {
+	// Read when the meter provider is created
+	t.Setenv("OTEL_GO_X_EXEMPLAR", "true")
+	t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", "trace_based")
+	recorder := useTestTracerProvider(t)
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	metrics, err := newRequestMetrics(mp.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newServerHandler(newHelloHandler(Config{}, metrics)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello?iterations=1&max_sleep_ms=0", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	spans := recorder.Ended()
+	if len(spans) == 0 {
+		t.Fatal("no span ended")
+	}
+	traceID := spans[len(spans)-1].SpanContext().TraceID()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http.request.duration" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok || len(hist.DataPoints) != 1 {
+				t.Fatalf("http.request.duration = %#v, want one histogram data point", m.Data)
+			}
+			exemplars := hist.DataPoints[0].Exemplars
+			if len(exemplars) != 1 {
+				t.Fatalf("got %d exemplars, want 1", len(exemplars))
+			}
+			if got := string(exemplars[0].TraceID); got != string(traceID[:]) {
+				t.Errorf("exemplar trace ID = %x, want %s", exemplars[0].TraceID, traceID)
+			}
+			return
+		}
+	}
+	t.Fatal("http.request.duration not recorded")
+}
+
+func TestHelloContinuesIncomingTraceparent(t *testing.T) {
+	recorder := useTestTracerProvider(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	metrics, err := newRequestMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/hello?iterations=1&max_sleep_ms=0", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	newServerHandler(newHelloHandler(Config{}, metrics)).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) == 0 {
+		t.Fatal("no span ended")
+	}
+	server := spans[len(spans)-1]
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the incoming one", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the incoming one", got)
+	}
+	if !server.Parent().IsRemote() {
+		t.Error("parent is not remote")
+	}
+}
+
+func TestHelloCountsRejectedRequests(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	metrics, err := newRequestMetrics(mp.Meter("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newServerHandler(newHelloHandler(Config{}, metrics)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello?iterations=100000&alloc_kb=65536", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http.requests.total" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 1 {
+				t.Errorf("http.requests.total = %#v, want one request", m.Data)
+			}
+			return
+		}
+	}
+	t.Fatal("http.requests.total not recorded")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// instrumentMetadata overrides the description and unit an instrument is
+// exported with. Empty fields keep the built-in value.
+type instrumentMetadata struct {
+	Description string `json:"description"`
+	Unit        string `json:"unit"`
+}
+
+// metadataViews parses METRIC_METADATA, a JSON object keyed by instrument name,
+// e.g. {"http.request.duration": {"description": "Request latency"}}, into
+// views that rewrite the matching instruments' metadata. Only the metadata
+// changes: overriding a unit does not convert the recorded values.
+func metadataViews(v string) ([]sdkmetric.View, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var overrides map[string]instrumentMetadata
+	if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid METRIC_METADATA: %w", err)
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	views := make([]sdkmetric.View, 0, len(names))
+	for _, name := range names {
+		md := overrides[name]
+		views = append(views, sdkmetric.NewView(
+			sdkmetric.Instrument{Name: name},
+			sdkmetric.Stream{Description: md.Description, Unit: md.Unit},
+		))
+	}
+	return views, nil
+}
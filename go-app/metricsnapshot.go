@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// handleMetricsSnapshot collects the current metrics through reader, a
+// manual reader dedicated to this endpoint, and returns them as an OTLP JSON
+// export request: exactly what the exporter would send, attributes and
+// exemplars included. Collecting through its own reader does not disturb
+// the periodic exports.
+func handleMetricsSnapshot(reader *sdkmetric.ManualReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(r.Context(), &rm); err != nil {
+			writeError(w, trace.SpanFromContext(r.Context()), errInternal, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		req := &colmetricpb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricpb.ResourceMetrics{resourceMetricsToOTLP(&rm)},
+		}
+		data, err := protojson.Marshal(req)
+		if err != nil {
+			writeError(w, trace.SpanFromContext(r.Context()), errInternal, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// OTLP JSON encodes trace and span IDs as hex, not protobuf's base64
+		var body any
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeError(w, trace.SpanFromContext(r.Context()), errInternal, http.StatusInternalServerError, err.Error())
+			return
+		}
+		hexIDs(body)
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// hexIDs rewrites every traceId and spanId in a decoded OTLP JSON document
+// from base64 to hex.
+func hexIDs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if s, ok := child.(string); ok && (k == "traceId" || k == "spanId") {
+				if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+					v[k] = hex.EncodeToString(b)
+				}
+				continue
+			}
+			hexIDs(child)
+		}
+	case []any:
+		for _, child := range v {
+			hexIDs(child)
+		}
+	}
+}
+
+func resourceMetricsToOTLP(rm *metricdata.ResourceMetrics) *metricpb.ResourceMetrics {
+	out := &metricpb.ResourceMetrics{
+		Resource:  &resourcepb.Resource{Attributes: attrsToOTLP(rm.Resource.Attributes())},
+		SchemaUrl: rm.Resource.SchemaURL(),
+	}
+	for _, sm := range rm.ScopeMetrics {
+		scope := &metricpb.ScopeMetrics{
+			Scope: &commonpb.InstrumentationScope{
+				Name:    sm.Scope.Name,
+				Version: sm.Scope.Version,
+			},
+			SchemaUrl: sm.Scope.SchemaURL,
+		}
+		for _, m := range sm.Metrics {
+			if pm := metricToOTLP(m); pm != nil {
+				scope.Metrics = append(scope.Metrics, pm)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, scope)
+	}
+	return out
+}
+
+// metricToOTLP converts the aggregations this app produces. Exponential
+// histograms are not used and are skipped.
+func metricToOTLP(m metricdata.Metrics) *metricpb.Metric {
+	out := &metricpb.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPointsToOTLP(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPointsToOTLP(data.DataPoints)}}
+	case metricdata.Sum[int64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: temporalityToOTLP(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+			DataPoints:             numberPointsToOTLP(data.DataPoints),
+		}}
+	case metricdata.Sum[float64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: temporalityToOTLP(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+			DataPoints:             numberPointsToOTLP(data.DataPoints),
+		}}
+	case metricdata.Histogram[int64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: temporalityToOTLP(data.Temporality),
+			DataPoints:             histogramPointsToOTLP(data.DataPoints),
+		}}
+	case metricdata.Histogram[float64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: temporalityToOTLP(data.Temporality),
+			DataPoints:             histogramPointsToOTLP(data.DataPoints),
+		}}
+	default:
+		return nil
+	}
+	return out
+}
+
+func temporalityToOTLP(t metricdata.Temporality) metricpb.AggregationTemporality {
+	switch t {
+	case metricdata.CumulativeTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	case metricdata.DeltaTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+	return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+}
+
+func numberPointsToOTLP[N int64 | float64](points []metricdata.DataPoint[N]) []*metricpb.NumberDataPoint {
+	out := make([]*metricpb.NumberDataPoint, 0, len(points))
+	for _, p := range points {
+		dp := &metricpb.NumberDataPoint{
+			Attributes:        attrsToOTLP(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Exemplars:         exemplarsToOTLP(p.Exemplars),
+		}
+		switch v := any(p.Value).(type) {
+		case int64:
+			dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			dp.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func histogramPointsToOTLP[N int64 | float64](points []metricdata.HistogramDataPoint[N]) []*metricpb.HistogramDataPoint {
+	out := make([]*metricpb.HistogramDataPoint, 0, len(points))
+	for _, p := range points {
+		sum := float64(p.Sum)
+		dp := &metricpb.HistogramDataPoint{
+			Attributes:        attrsToOTLP(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               &sum,
+			BucketCounts:      p.BucketCounts,
+			ExplicitBounds:    p.Bounds,
+			Exemplars:         exemplarsToOTLP(p.Exemplars),
+		}
+		if v, ok := p.Min.Value(); ok {
+			min := float64(v)
+			dp.Min = &min
+		}
+		if v, ok := p.Max.Value(); ok {
+			max := float64(v)
+			dp.Max = &max
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func exemplarsToOTLP[N int64 | float64](exemplars []metricdata.Exemplar[N]) []*metricpb.Exemplar {
+	out := make([]*metricpb.Exemplar, 0, len(exemplars))
+	for _, e := range exemplars {
+		ex := &metricpb.Exemplar{
+			FilteredAttributes: attrsToOTLP(e.FilteredAttributes),
+			TimeUnixNano:       unixNano(e.Time),
+			SpanId:             e.SpanID,
+			TraceId:            e.TraceID,
+		}
+		switch v := any(e.Value).(type) {
+		case int64:
+			ex.Value = &metricpb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			ex.Value = &metricpb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, ex)
+	}
+	return out
+}
+
+// unixNano converts t to an OTLP timestamp. Gauges have no start time, and
+// the zero time is left unset rather than overflowing.
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func attrsToOTLP(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: attrValueToOTLP(kv.Value)})
+	}
+	return out
+}
+
+func attrValueToOTLP(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.BOOLSLICE:
+		return arrayToOTLP(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return arrayToOTLP(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return arrayToOTLP(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return arrayToOTLP(v.AsStringSlice(), attribute.StringValue)
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+}
+
+func arrayToOTLP[T any](values []T, toValue func(T) attribute.Value) *commonpb.AnyValue {
+	arr := &commonpb.ArrayValue{Values: make([]*commonpb.AnyValue, 0, len(values))}
+	for _, v := range values {
+		arr.Values = append(arr.Values, attrValueToOTLP(toValue(v)))
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+}
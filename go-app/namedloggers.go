@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Subsystem loggers, derived from the global logger with Named. Each has its
+// own level, adjustable at runtime through /debug/loglevel.
+const (
+	loggerHTTP       = "http"       // request handling
+	loggerBackground = "background" // periodic and reload work
+	loggerOTel       = "otel"       // the telemetry pipeline itself
+)
+
+// namedLoggers holds the levels of the root logger ("") and the subsystem
+// loggers. Set up in main from LOG_LEVEL and LOG_LEVELS.
+var namedLoggers = newLoggerLevels(zapcore.InfoLevel)
+
+// loggerLevels maps logger names to independently adjustable levels. A
+// logger without a level of its own, like "http.client", uses the level of
+// its closest named parent, and in the end the root's.
+type loggerLevels struct {
+	mu     sync.RWMutex
+	levels map[string]zap.AtomicLevel
+}
+
+func newLoggerLevels(root zapcore.Level) *loggerLevels {
+	l := &loggerLevels{levels: map[string]zap.AtomicLevel{}}
+	for _, name := range []string{"", loggerHTTP, loggerBackground, loggerOTel} {
+		l.levels[name] = zap.NewAtomicLevelAt(root)
+	}
+	return l
+}
+
+// parse applies LOG_LEVELS, comma-separated name=level pairs, e.g.
+// "http=debug,otel=warn".
+func (l *loggerLevels) parse(v string) error {
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid logger level %q: want name=level", pair)
+		}
+		if err := l.set(strings.TrimSpace(name), strings.TrimSpace(level)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set changes the level of the known logger name.
+func (l *loggerLevels) set(name, level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	atomic, ok := l.levels[name]
+	if !ok {
+		return fmt.Errorf("unknown logger %q", name)
+	}
+	atomic.SetLevel(lvl)
+	return nil
+}
+
+// levelFor returns the level in effect for the logger called name.
+func (l *loggerLevels) levelFor(name string) zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for {
+		if atomic, ok := l.levels[name]; ok {
+			return atomic.Level()
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return l.levels[""].Level()
+		}
+		name = name[:i]
+	}
+}
+
+// minLevel returns the least severe level any logger is enabled at.
+func (l *loggerLevels) minLevel() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	min := zapcore.InvalidLevel
+	for _, atomic := range l.levels {
+		if lvl := atomic.Level(); min == zapcore.InvalidLevel || lvl < min {
+			min = lvl
+		}
+	}
+	return min
+}
+
+// snapshot returns the level of every known logger, by name.
+func (l *loggerLevels) snapshot() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make(map[string]string, len(l.levels))
+	for name, atomic := range l.levels {
+		out[name] = atomic.Level().String()
+	}
+	return out
+}
+
+// names returns the known logger names, sorted.
+func (l *loggerLevels) names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	names := make([]string, 0, len(l.levels))
+	for name := range l.levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedLevelCore drops entries below the level of the logger that wrote
+// them. The cores it wraps must let every level through.
+type namedLevelCore struct {
+	zapcore.Core
+	levels *loggerLevels
+}
+
+func newNamedLevelCore(core zapcore.Core, levels *loggerLevels) zapcore.Core {
+	return &namedLevelCore{Core: core, levels: levels}
+}
+
+// Enabled answers for the most verbose logger; Check decides per logger.
+func (c *namedLevelCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.levels.minLevel()
+}
+
+func (c *namedLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &namedLevelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *namedLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.levels.levelFor(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// handleLogLevel reports the level of every named logger on GET, and on PUT
+// sets the level of the one in ?logger= (the root when empty) to ?level=.
+func handleLogLevel(levels *loggerLevels) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			q := r.URL.Query()
+			if err := levels.set(q.Get("logger"), q.Get("level")); err != nil {
+				msg := fmt.Sprintf("%v; loggers are %q", err, levels.names())
+				writeError(w, span, errValidation, http.StatusBadRequest, msg)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeError(w, span, errValidation, http.StatusMethodNotAllowed, "use GET or PUT")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"levels": levels.snapshot()})
+	}
+}
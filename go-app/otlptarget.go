@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// OTLP protocols accepted in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	otlpProtocolHTTP = "http/protobuf"
+	otlpProtocolGRPC = "grpc"
+)
+
+// newOTLPTLSConfig returns the exporters' TLS configuration: nil when
+// insecure, otherwise one trusting the system roots plus the PEM
+// certificates in caFile, if set.
+func newOTLPTLSConfig(insecure bool, caFile string) (*tls.Config, error) {
+	if insecure {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", caFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+// parseOTLPProtocol validates an OTEL_EXPORTER_OTLP_PROTOCOL value, which
+// defaults to http/protobuf.
+func parseOTLPProtocol(v string) (string, error) {
+	switch v = strings.TrimSpace(v); v {
+	case "", otlpProtocolHTTP:
+		return otlpProtocolHTTP, nil
+	case otlpProtocolGRPC:
+		return otlpProtocolGRPC, nil
+	}
+	return "", fmt.Errorf("unsupported OTLP protocol %q, want %q or %q", v, otlpProtocolHTTP, otlpProtocolGRPC)
+}
+
+// defaultOTLPEndpoint is the collector's standard receiver address for
+// protocol.
+func defaultOTLPEndpoint(protocol string) string {
+	if protocol == otlpProtocolGRPC {
+		return "localhost:4317"
+	}
+	return "localhost:4318"
+}
+
+// unixSocketPath returns the socket path of a unix:// endpoint, such as
+// unix:///var/run/otel/otlp.sock for a node-local collector, and whether
+// endpoint is one. Unix endpoints are only supported over gRPC.
+func unixSocketPath(endpoint string) (string, bool) {
+	return strings.CutPrefix(endpoint, "unix://")
+}
+
+// checkUnixSocket returns an error unless path is an existing socket.
+func checkUnixSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", path)
+	}
+	return nil
+}
+
+// grpcTarget returns the gRPC dial target for endpoint and the dial options
+// it needs. A unix:// endpoint is dialed through a custom dialer, with
+// localhost as the authority.
+func grpcTarget(endpoint string) (string, []grpc.DialOption) {
+	path, ok := unixSocketPath(endpoint)
+	if !ok {
+		return endpoint, nil
+	}
+	return "localhost", []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}),
+	}
+}
+
+// otlpTarget is where OTLP exports are sent: the collector endpoint and the
+// headers, such as auth, sent with every export request. They can be changed
+// at runtime; exporters built from it pick up the change on their next
+// export. The protocol and TLS configuration are fixed.
+type otlpTarget struct {
+	protocol string
+	tls      *tls.Config // nil exports in plaintext
+
+	mu       sync.RWMutex
+	endpoint string
+	headers  map[string]string
+	version  uint64
+
+	// parent is the target a derived target follows. Its endpoint, if set,
+	// and headers then apply on top of the parent's and never change.
+	parent *otlpTarget
+
+	// failures tracks the exports of every exporter built from the target
+	failures *exportFailureTracker
+}
+
+func newOTLPTarget(protocol string, tlsConfig *tls.Config, endpoint string, headers map[string]string) *otlpTarget {
+	return &otlpTarget{
+		protocol: protocol,
+		tls:      tlsConfig,
+		endpoint: endpoint,
+		headers:  headers,
+		failures: &exportFailureTracker{},
+	}
+}
+
+// derive returns a target that follows t, sending to endpoint instead if it
+// is set, with headers added to t's. Changes to t, such as a reload, apply
+// to it too. It can't be set itself.
+func (t *otlpTarget) derive(endpoint string, headers map[string]string) *otlpTarget {
+	return &otlpTarget{
+		protocol: t.protocol,
+		tls:      t.tls,
+		endpoint: endpoint,
+		headers:  headers,
+		parent:   t,
+		failures: &exportFailureTracker{},
+	}
+}
+
+// Endpoint returns the current collector endpoint.
+func (t *otlpTarget) Endpoint() string {
+	endpoint, _, _ := t.snapshot()
+	return endpoint
+}
+
+func (t *otlpTarget) snapshot() (endpoint string, headers map[string]string, version uint64) {
+	if t.parent == nil {
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		return t.endpoint, t.headers, t.version
+	}
+
+	endpoint, parentHeaders, version := t.parent.snapshot()
+	if t.endpoint != "" {
+		endpoint = t.endpoint
+	}
+	headers = make(map[string]string, len(parentHeaders)+len(t.headers))
+	for k, v := range parentHeaders {
+		headers[k] = v
+	}
+	for k, v := range t.headers {
+		headers[k] = v
+	}
+	return endpoint, headers, version
+}
+
+// set updates the target and reports whether anything changed.
+func (t *otlpTarget) set(endpoint string, headers map[string]string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if endpoint == t.endpoint && equalHeaders(headers, t.headers) {
+		return false
+	}
+	t.endpoint, t.headers = endpoint, headers
+	t.version++
+	return true
+}
+
+func equalHeaders(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// otlpSecretFiles reads the OTLP endpoint and headers from mounted secret
+// files, as Kubernetes secrets usually are. A file takes precedence over the
+// corresponding environment variable; unset files fall back to it.
+type otlpSecretFiles struct {
+	endpointFile    string
+	headersFile     string
+	defaultEndpoint string
+	defaultHeaders  map[string]string
+}
+
+// load returns the endpoint and headers to use.
+func (f otlpSecretFiles) load() (string, map[string]string, error) {
+	endpoint := f.defaultEndpoint
+	if f.endpointFile != "" {
+		data, err := os.ReadFile(f.endpointFile)
+		if err != nil {
+			return "", nil, err
+		}
+		if endpoint = strings.TrimSpace(string(data)); endpoint == "" {
+			return "", nil, fmt.Errorf("%s: empty endpoint", f.endpointFile)
+		}
+	}
+
+	headers := f.defaultHeaders
+	if f.headersFile != "" {
+		data, err := os.ReadFile(f.headersFile)
+		if err != nil {
+			return "", nil, err
+		}
+		if headers, err = parseOTLPHeaders(strings.TrimSpace(string(data))); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", f.headersFile, err)
+		}
+	}
+	return endpoint, headers, nil
+}
+
+// reloadOnSIGHUP re-reads the files into target whenever the process
+// receives SIGHUP. Files that fail to load are logged and the previous
+// target is kept.
+func (f otlpSecretFiles) reloadOnSIGHUP(target *otlpTarget) {
+	if f.endpointFile == "" && f.headersFile == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			endpoint, headers, err := f.load()
+			if err != nil {
+				zap.L().Named(loggerBackground).Error("failed to reload OTLP secret files", zap.Error(err))
+				continue
+			}
+			if target.set(endpoint, headers) {
+				zap.L().Named(loggerBackground).Info("reloaded OTLP target from secret files", zap.String("endpoint", endpoint))
+			}
+		}
+	}()
+}
+
+// parseOTLPHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format:
+// comma-separated key=value pairs with URL-encoded values.
+func parseOTLPHeaders(v string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid header %q", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %w", key, err)
+		}
+		headers[key] = value
+	}
+	return headers, nil
+}
+
+// newOTLPSpanExporter builds a span exporter for endpoint, a host:port
+// address or, over gRPC, a unix:// socket, over the target's protocol.
+func (t *otlpTarget) newOTLPSpanExporter(ctx context.Context, endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	if t.protocol == otlpProtocolGRPC {
+		target, dialOpts := grpcTarget(endpoint)
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(target),
+			otlptracegrpc.WithDialOption(append(dialOpts, withConnState("traces"))...),
+			otlptracegrpc.WithTimeout(exportTimeout),
+			otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{
+				Enabled:         true,
+				InitialInterval: exportRetryInitial,
+				MaxInterval:     exportRetryMaxInterval,
+				MaxElapsedTime:  exportRetryMaxElapsed,
+			}),
+		}
+		if t.tls == nil {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		if len(headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(headers))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint),
+		otlptracehttp.WithTimeout(exportTimeout),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{
+			Enabled:         true,
+			InitialInterval: exportRetryInitial,
+			MaxInterval:     exportRetryMaxInterval,
+			MaxElapsedTime:  exportRetryMaxElapsed,
+		}),
+	}
+	if t.tls == nil {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(t.tls))
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// newOTLPMetricExporter builds a metric exporter for endpoint, a host:port
+// address or, over gRPC, a unix:// socket, over the target's protocol.
+func (t *otlpTarget) newOTLPMetricExporter(ctx context.Context, endpoint string, headers map[string]string) (sdkmetric.Exporter, error) {
+	if t.protocol == otlpProtocolGRPC {
+		target, dialOpts := grpcTarget(endpoint)
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(target),
+			otlpmetricgrpc.WithDialOption(append(dialOpts, withConnState("metrics"))...),
+			otlpmetricgrpc.WithTimeout(exportTimeout),
+			otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{
+				Enabled:         true,
+				InitialInterval: exportRetryInitial,
+				MaxInterval:     exportRetryMaxInterval,
+				MaxElapsedTime:  exportRetryMaxElapsed,
+			}),
+		}
+		if t.tls == nil {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		if len(headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(headers))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(endpoint),
+		otlpmetrichttp.WithTimeout(exportTimeout),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{
+			Enabled:         true,
+			InitialInterval: exportRetryInitial,
+			MaxInterval:     exportRetryMaxInterval,
+			MaxElapsedTime:  exportRetryMaxElapsed,
+		}),
+	}
+	if t.tls == nil {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(t.tls))
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(headers))
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+// targetSpanExporter exports spans to an otlpTarget, rebuilding its OTLP
+// exporter when the target changes.
+type targetSpanExporter struct {
+	target *otlpTarget
+
+	mu      sync.Mutex
+	version uint64
+	exp     sdktrace.SpanExporter
+}
+
+var _ sdktrace.SpanExporter = (*targetSpanExporter)(nil)
+
+func newTargetSpanExporter(ctx context.Context, target *otlpTarget) (*targetSpanExporter, error) {
+	endpoint, headers, version := target.snapshot()
+	exp, err := target.newOTLPSpanExporter(ctx, endpoint, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &targetSpanExporter{target: target, version: version, exp: exp}, nil
+}
+
+func (e *targetSpanExporter) current(ctx context.Context) (sdktrace.SpanExporter, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	endpoint, headers, version := e.target.snapshot()
+	if version != e.version {
+		exp, err := e.target.newOTLPSpanExporter(ctx, endpoint, headers)
+		if err != nil {
+			return nil, err
+		}
+		old := e.exp
+		go old.Shutdown(context.Background())
+		e.exp, e.version = exp, version
+	}
+	return e.exp, nil
+}
+
+func (e *targetSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	exp, err := e.current(ctx)
+	if err == nil {
+		err = exp.ExportSpans(ctx, spans)
+	}
+	f := e.target.failures
+	f.record(&f.traces, err)
+	return err
+}
+
+func (e *targetSpanExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exp.Shutdown(ctx)
+}
+
+// targetMetricExporter exports metrics to an otlpTarget, rebuilding its OTLP
+// exporter when the target changes.
+type targetMetricExporter struct {
+	target *otlpTarget
+
+	mu      sync.Mutex
+	version uint64
+	exp     sdkmetric.Exporter
+}
+
+var _ sdkmetric.Exporter = (*targetMetricExporter)(nil)
+
+func newTargetMetricExporter(ctx context.Context, target *otlpTarget) (*targetMetricExporter, error) {
+	endpoint, headers, version := target.snapshot()
+	exp, err := target.newOTLPMetricExporter(ctx, endpoint, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &targetMetricExporter{target: target, version: version, exp: exp}, nil
+}
+
+func (e *targetMetricExporter) current(ctx context.Context) (sdkmetric.Exporter, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	endpoint, headers, version := e.target.snapshot()
+	if version != e.version {
+		exp, err := e.target.newOTLPMetricExporter(ctx, endpoint, headers)
+		if err != nil {
+			return nil, err
+		}
+		old := e.exp
+		go old.Shutdown(context.Background())
+		e.exp, e.version = exp, version
+	}
+	return e.exp, nil
+}
+
+// Temporality and Aggregation don't depend on the target, so they come from
+// whichever exporter is current.
+func (e *targetMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exp.Temporality(k)
+}
+
+func (e *targetMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exp.Aggregation(k)
+}
+
+func (e *targetMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	exp, err := e.current(ctx)
+	if err == nil {
+		err = exp.Export(ctx, rm)
+	}
+	f := e.target.failures
+	f.record(&f.metrics, err)
+	return err
+}
+
+func (e *targetMetricExporter) ForceFlush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exp.ForceFlush(ctx)
+}
+
+func (e *targetMetricExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exp.Shutdown(ctx)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpMetricsReceiver is an OTLP/HTTP collector that remembers the names of
+// the metrics exported to it.
+type otlpMetricsReceiver struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (rc *otlpMetricsReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req colmetricpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				rc.names[m.Name] = true
+			}
+		}
+	}
+	rc.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(nil)
+}
+
+func (rc *otlpMetricsReceiver) received(name string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.names[name]
+}
+
+func TestShutdownMeterProviderExportsPendingValues(t *testing.T) {
+	rc := &otlpMetricsReceiver{names: map[string]bool{}}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	target := newOTLPTarget(otlpProtocolHTTP, nil, strings.TrimPrefix(srv.URL, "http://"), nil)
+	// Far longer than the test, so only the shutdown can export
+	mp, err := newMeterProvider(ctx, resource.Empty(), target, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := mp.Meter("test").Int64Counter("test.requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(ctx, 1)
+
+	if err := shutdownMeterProvider(ctx, mp); err != nil {
+		t.Fatal(err)
+	}
+	if !rc.received("test.requests") {
+		t.Error("test.requests was not exported on shutdown")
+	}
+}
+
+func TestDerivedTargetFollowsParent(t *testing.T) {
+	parent := newOTLPTarget(otlpProtocolHTTP, nil, "collector:4318", map[string]string{"Authorization": "Basic a"})
+	derived := parent.derive("", map[string]string{tenantOrgIDHeader: "acme"})
+	own := parent.derive("acme-collector:4318", map[string]string{tenantOrgIDHeader: "acme"})
+
+	parent.set("collector-2:4318", map[string]string{"Authorization": "Basic b"})
+
+	endpoint, headers, version := derived.snapshot()
+	if endpoint != "collector-2:4318" {
+		t.Errorf("endpoint = %q, want the reloaded one", endpoint)
+	}
+	if headers["Authorization"] != "Basic b" || headers[tenantOrgIDHeader] != "acme" {
+		t.Errorf("headers = %v, want the reloaded auth and the tenant", headers)
+	}
+	if _, _, parentVersion := parent.snapshot(); version != parentVersion {
+		t.Errorf("version = %d, want the parent's %d", version, parentVersion)
+	}
+	if got := own.Endpoint(); got != "acme-collector:4318" {
+		t.Errorf("endpoint = %q, want the tenant's own", got)
+	}
+}
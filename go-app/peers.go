@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// defaultPeerServices names the simulated upstream each outbound client span
+// talks to. Tempo's service graph draws an edge to peer.service for client
+// spans that have no matching server span, so these show up as nodes.
+// Override with PEER_SERVICES.
+var defaultPeerServices = map[string]string{
+	"external.wait": "external-api",
+	"cache.get":     "cache",
+	"backend.fetch": "backend",
+}
+
+// parsePeerServices parses PEER_SERVICES, a comma-separated list of
+// span=service pairs, on top of the defaults.
+func parsePeerServices(v string) map[string]string {
+	peers := make(map[string]string, len(defaultPeerServices))
+	for span, service := range defaultPeerServices {
+		peers[span] = service
+	}
+	for _, pair := range strings.Split(v, ",") {
+		span, service, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && span != "" && service != "" {
+			peers[span] = service
+		}
+	}
+	return peers
+}
+
+// peerServiceAttrs returns the peer.service attribute for the client span
+// named span, if peers gives it an upstream.
+func peerServiceAttrs(peers map[string]string, span string) []attribute.KeyValue {
+	service, ok := peers[span]
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.PeerService(service)}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// registerPprofLabelGauge reports how many distinct pprof label sets are
+// attached to live goroutines. The handler labels goroutines with the
+// trace_id, so this climbs with concurrency; a steadily growing value means
+// label cardinality in the profiles is getting out of hand.
+func registerPprofLabelGauge(meter metric.Meter) error {
+	_, err := meter.Int64ObservableGauge(
+		"pprof.goroutine.label_sets",
+		metric.WithDescription("Number of distinct pprof label sets on live goroutines"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			n, err := countGoroutineLabelSets()
+			if err != nil {
+				return err
+			}
+			o.Observe(int64(n))
+			return nil
+		}),
+	)
+	return err
+}
+
+// requestProfileLabels are the pprof labels attached to a request's goroutine
+// so profiles can be filtered down to a single trace.
+func requestProfileLabels(traceID string) pprof.LabelSet {
+	return pprof.Labels("trace_id", traceID)
+}
+
+// profileRegion runs fn with the pprof label region=name on top of the
+// request's labels, so profiles can be broken down by phase. With withSpan
+// it also runs fn in a span called name, and labels the
+// region with that span's span_id: each region in a flame graph then matches
+// exactly one span in Tempo, and the span links back to it.
+func profileRegion(ctx context.Context, tracer trace.Tracer, name string, withSpan bool, fn func(context.Context)) {
+	labels := []string{"region", name}
+	if withSpan {
+		var span trace.Span
+		ctx, span = startSpan(ctx, tracer, name, trace.WithAttributes(attribute.String("pprof.region", name)))
+		defer span.End()
+		labels = append(labels, "span_id", span.SpanContext().SpanID().String())
+	}
+	pprof.Do(ctx, pprof.Labels(labels...), fn)
+}
+
+func countGoroutineLabelSets() (int, error) {
+	sets, err := goroutineLabelSets()
+	return len(sets), err
+}
+
+// goroutineLabelSets parses the text goroutine profile, which prints a
+// "# labels: {...}" line for every group of goroutines sharing labels.
+func goroutineLabelSets() (map[string]struct{}, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string]struct{})
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if labels, ok := strings.CutPrefix(scanner.Text(), "# labels: "); ok {
+			sets[labels] = struct{}{}
+		}
+	}
+	return sets, scanner.Err()
+}
+
+// goroutineHasLabel reports whether the calling goroutine carries
+// key=value. Before Go 1.22 the goroutine profile left out the labels of the
+// goroutine taking it, and the app is built with Go 1.21, so a probe
+// goroutine, which inherits the caller's labels, is parked and looked for
+// instead. On later versions the caller's own entry matches as well.
+func goroutineHasLabel(key, value string) (bool, error) {
+	parked := make(chan struct{})
+	release := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		close(parked)
+		<-release
+	}()
+	<-parked
+	defer func() {
+		close(release)
+		<-exited
+	}()
+
+	needle := strconv.Quote(key) + ":" + strconv.Quote(value)
+	// The probe may not have parked yet on the first look, so retry briefly.
+	for attempt := 0; attempt < 3; attempt++ {
+		sets, err := goroutineLabelSets()
+		if err != nil {
+			return false, err
+		}
+		for set := range sets {
+			if strings.Contains(set, needle) {
+				return true, nil
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false, nil
+}
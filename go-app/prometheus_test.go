@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestPrometheusScrapeHasTraceIDExemplar(t *testing.T) {
+	// Read when the meter provider is created
+	t.Setenv("OTEL_GO_X_EXEMPLAR", "true")
+	t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", "trace_based")
+
+	reg := prometheus.NewRegistry()
+	exp, err := otelprometheus.New(otelprometheus.WithRegisterer(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exp))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	hist, err := mp.Meter("test").Float64Histogram("http.request.duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	hist.Record(ctx, 12)
+	span.End()
+
+	srv := httptest.NewServer(prometheusHandler(reg))
+	t.Cleanup(srv.Close)
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As Prometheus sends it with exemplar storage enabled
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Content-Type = %q, want OpenMetrics", ct)
+	}
+	want := `trace_id="` + span.SpanContext().TraceID().String() + `"`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("scrape has no exemplar with %s:\n%s", want, body)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/pyroscope-io/client/pyroscope"
+)
+
+// profileTypes are the profiles pushed to Pyroscope: the defaults plus the
+// mutex and block profiles, which main turns on with
+// runtime.SetMutexProfileFraction and runtime.SetBlockProfileRate.
+var profileTypes = append(append([]pyroscope.ProfileType{}, pyroscope.DefaultProfileTypes...),
+	pyroscope.ProfileMutexCount,
+	pyroscope.ProfileMutexDuration,
+	pyroscope.ProfileBlockCount,
+	pyroscope.ProfileBlockDuration,
+)
+
+// startProfiler starts pushing profiles to the Pyroscope server in cfg. The
+// application is named after the service, as on traces and metrics, and
+// profiles are tagged with the service version and deployment environment so
+// they can be told apart across releases and environments.
+func startProfiler(cfg Config) (*pyroscope.Profiler, error) {
+	tags := map[string]string{"service_version": cfg.ServiceVersion}
+	if cfg.DeploymentEnvironment != "" {
+		tags["deployment_environment"] = cfg.DeploymentEnvironment
+	}
+	return pyroscope.Start(pyroscope.Config{
+		ApplicationName: cfg.ServiceName,
+		ServerAddress:   cfg.PyroscopeAddr,
+		Tags:            tags,
+		ProfileTypes:    profileTypes,
+	})
+}
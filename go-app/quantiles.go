@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// durationQuantiles are the quantiles reported by the sliding window.
+var durationQuantiles = []float64{0.5, 0.95, 0.99}
+
+// maxWindowSamples bounds the memory a window holds under heavy load. Past
+// it the oldest samples are dropped early, shortening the effective window.
+const maxWindowSamples = 10000
+
+// requestDurationWindow additionally reports request duration quantiles
+// computed in-process, when set from DURATION_QUANTILES_WINDOW.
+var requestDurationWindow *slidingWindow
+
+type windowSample struct {
+	at    time.Time
+	value float64
+}
+
+// slidingWindow keeps the samples recorded over the last window, in the
+// order they were recorded, to compute exact quantiles over them.
+type slidingWindow struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	samples []windowSample
+}
+
+func newSlidingWindow(window time.Duration) *slidingWindow {
+	return &slidingWindow{window: window}
+}
+
+func (w *slidingWindow) record(v float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.expire(now)
+	if len(w.samples) >= maxWindowSamples {
+		w.samples = w.samples[1:]
+	}
+	w.samples = append(w.samples, windowSample{at: now, value: v})
+}
+
+// expire drops the samples older than the window. w.mu must be held.
+func (w *slidingWindow) expire(now time.Time) {
+	cutoff := now.Add(-w.window)
+	i := 0
+	for i < len(w.samples) && w.samples[i].at.Before(cutoff) {
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
+// quantiles returns the nearest-rank value for each of qs, or nil when the
+// window is empty.
+func (w *slidingWindow) quantiles(qs []float64) []float64 {
+	w.mu.Lock()
+	w.expire(time.Now())
+	values := make([]float64, len(w.samples))
+	for i, s := range w.samples {
+		values[i] = s.value
+	}
+	w.mu.Unlock()
+
+	if len(values) == 0 {
+		return nil
+	}
+	slices.Sort(values)
+	out := make([]float64, len(qs))
+	for i, q := range qs {
+		rank := int(math.Ceil(q*float64(len(values)))) - 1
+		out[i] = values[max(rank, 0)]
+	}
+	return out
+}
+
+// registerGauge reports the window's quantiles as a gauge with a quantile
+// attribute, much like a Prometheus summary. Nothing is reported while the
+// window is empty, so idle periods show as gaps rather than zeros.
+func (w *slidingWindow) registerGauge(meter metric.Meter) error {
+	_, err := meter.Float64ObservableGauge(
+		"http.request.duration.quantile",
+		metric.WithDescription("HTTP request duration quantiles over a sliding window, computed in-process"),
+		metric.WithUnit("ms"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			for i, v := range w.quantiles(durationQuantiles) {
+				o.Observe(v, metric.WithAttributes(attribute.Float64("quantile", durationQuantiles[i])))
+			}
+			return nil
+		}),
+	)
+	return err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// telemetryReady is set once telemetry is known to get through: by the
+// first successful export to the main OTLP target, or by main once the
+// collector accepts a connection, whichever comes first. Initialized
+// providers alone say nothing about whether anything reaches the collector.
+var telemetryReady atomic.Bool
+
+// dependency is something the service needs to do useful work. A critical
+// dependency being down makes the service not ready.
+type dependency struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+// dependencyStatus is one entry of the /readyz response.
+type dependencyStatus struct {
+	Name     string `json:"name"`
+	Critical bool   `json:"critical"`
+	Up       bool   `json:"up"`
+	Error    string `json:"error,omitempty"`
+}
+
+// flagDependency reports whether ready is set, for subsystems that become
+// ready once during startup.
+func flagDependency(name string, ready *atomic.Bool) dependency {
+	return dependency{
+		name:     name,
+		critical: true,
+		check: func(context.Context) error {
+			if !ready.Load() {
+				return errors.New("not ready yet")
+			}
+			return nil
+		},
+	}
+}
+
+// setWhenUp sets ready once dep is up, checking it every
+// collectorWaitInterval until ready is set some other way or ctx is done.
+func setWhenUp(ctx context.Context, ready *atomic.Bool, dep dependency) {
+	for !ready.Load() {
+		checkCtx, cancel := context.WithTimeout(ctx, collectorWaitInterval)
+		err := dep.check(checkCtx)
+		cancel()
+		if err == nil {
+			ready.Store(true)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(collectorWaitInterval):
+		}
+	}
+}
+
+// tcpDependency checks that the address returned by addr accepts TCP
+// connections, or for a unix:// address that its socket does. addr is called
+// on every check so the address may change.
+func tcpDependency(name string, addr func() string, critical bool) dependency {
+	return dependency{
+		name:     name,
+		critical: critical,
+		check: func(ctx context.Context) error {
+			network, address := "tcp", addr()
+			if path, ok := unixSocketPath(address); ok {
+				network, address = "unix", path
+			}
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, address)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// httpDependency checks that url answers a GET without a server error.
+func httpDependency(name, url string, critical bool) dependency {
+	return dependency{
+		name:     name,
+		critical: critical,
+		check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				return fmt.Errorf("status %d", resp.StatusCode)
+			}
+			return nil
+		},
+	}
+}
+
+// parseReadinessURLs parses READINESS_URLS, a comma-separated list of
+// name=url pairs. Names listed in optional are not critical.
+func parseReadinessURLs(v, optional string) []dependency {
+	nonCritical := map[string]bool{}
+	for _, name := range strings.Split(optional, ",") {
+		nonCritical[strings.TrimSpace(name)] = true
+	}
+
+	var deps []dependency
+	for _, pair := range strings.Split(v, ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && name != "" && url != "" {
+			deps = append(deps, httpDependency(name, url, !nonCritical[name]))
+		}
+	}
+	return deps
+}
+
+// handleReadyz checks every dependency concurrently, each bounded by timeout,
+// and answers 503 if any critical one is down. The body lists each
+// dependency's status.
+func handleReadyz(deps []dependency, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		statuses := make([]dependencyStatus, len(deps))
+		var wg sync.WaitGroup
+		for i, dep := range deps {
+			wg.Add(1)
+			go func(i int, dep dependency) {
+				defer wg.Done()
+				st := dependencyStatus{Name: dep.name, Critical: dep.critical, Up: true}
+				if err := dep.check(ctx); err != nil {
+					st.Up = false
+					st.Error = err.Error()
+				}
+				statuses[i] = st
+			}(i, dep)
+		}
+		wg.Wait()
+
+		ready := true
+		for _, st := range statuses {
+			if st.Critical && !st.Up {
+				ready = false
+			}
+		}
+
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, map[string]any{
+			"ready":        ready,
+			"dependencies": statuses,
+		})
+	}
+}
+
+// handleHealthz reports that the process is up and serving HTTP. Unlike
+// /readyz it checks nothing else, so a failing dependency never gets the
+// process restarted.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTelemetryReadyAfterSuccessfulExport(t *testing.T) {
+	prev := telemetryReady.Load()
+	telemetryReady.Store(false)
+	t.Cleanup(func() { telemetryReady.Store(prev) })
+
+	failures := &exportFailureTracker{ready: &telemetryReady}
+	failures.record(&failures.traces, errors.New("connection refused"))
+	if telemetryReady.Load() {
+		t.Fatal("telemetry ready after a failed export")
+	}
+	failures.record(&failures.traces, nil)
+	if !telemetryReady.Load() {
+		t.Error("telemetry not ready after a successful export")
+	}
+}
+
+func TestSetWhenUpStopsWithContext(t *testing.T) {
+	var ready atomic.Bool
+	down := dependency{name: "collector", check: func(context.Context) error {
+		return errors.New("connection refused")
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	setWhenUp(ctx, &ready, down)
+	if ready.Load() {
+		t.Error("ready set while the dependency is down")
+	}
+
+	up := dependency{name: "collector", check: func(context.Context) error { return nil }}
+	setWhenUp(context.Background(), &ready, up)
+	if !ready.Load() {
+		t.Error("ready not set once the dependency is up")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// exporterReconnects counts the connections gRPC exporters re-establish to
+// the collector. Set in main by registerReconnectCounter.
+var exporterReconnects metric.Int64Counter = noop.Int64Counter{}
+
+func registerReconnectCounter(meter metric.Meter) error {
+	counter, err := meter.Int64Counter(
+		"otel.exporter.reconnects.total",
+		metric.WithDescription("Number of times a gRPC OTLP exporter connected to the collector again after its first connection, by signal"),
+	)
+	if err != nil {
+		return err
+	}
+	exporterReconnects = counter
+	return nil
+}
+
+// connStateHandler is a gRPC stats handler that logs an exporter's
+// connections to the collector opening and closing, and counts every
+// connection after the first in otel.exporter.reconnects.total. It only
+// applies to the gRPC exporters: over HTTP each export is a request of its
+// own, with no connection state to watch.
+type connStateHandler struct {
+	signal    string
+	connected atomic.Bool // a connection was established before
+}
+
+// withConnState returns the dial option that watches the connection of the
+// gRPC exporter for signal.
+func withConnState(signal string) grpc.DialOption {
+	return grpc.WithStatsHandler(&connStateHandler{signal: signal})
+}
+
+func (h *connStateHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connStateHandler) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (h *connStateHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connStateHandler) HandleConn(_ context.Context, s stats.ConnStats) {
+	logger := zap.L().Named(loggerOTel)
+	switch s.(type) {
+	case *stats.ConnBegin:
+		if !h.connected.Swap(true) {
+			logger.Debug("OTLP exporter connected", zap.String("signal", h.signal))
+			return
+		}
+		exporterReconnects.Add(context.Background(), 1,
+			metric.WithAttributes(attribute.String("signal", h.signal)),
+		)
+		logger.Info("OTLP exporter reconnected", zap.String("signal", h.signal))
+	case *stats.ConnEnd:
+		// Also seen when the exporter shuts down, so not necessarily an error
+		logger.Info("OTLP exporter connection closed", zap.String("signal", h.signal))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/stats"
+)
+
+func TestConnStateHandlerCountsReconnects(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	prev := exporterReconnects
+	t.Cleanup(func() { exporterReconnects = prev })
+	if err := registerReconnectCounter(mp.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	h := &connStateHandler{signal: "traces"}
+	h.HandleConn(ctx, &stats.ConnBegin{Client: true})
+	h.HandleConn(ctx, &stats.ConnEnd{Client: true})
+	h.HandleConn(ctx, &stats.ConnBegin{Client: true})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "otel.exporter.reconnects.total" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 1 {
+				t.Errorf("otel.exporter.reconnects.total = %#v, want one reconnect", m.Data)
+			}
+			return
+		}
+	}
+	t.Fatal("otel.exporter.reconnects.total not recorded")
+}
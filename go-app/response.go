@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Request outcomes used to label the request duration histogram.
+const (
+	outcomeSuccess   = "success"
+	outcomeError     = "error"
+	outcomeTimeout   = "timeout"
+	outcomeCancelled = "cancelled"
+)
+
+// responseRecorder wraps an http.ResponseWriter to remember the status code
+// written by the handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, if the wrapped writer can.
+// Handlers that stream check for http.Flusher directly.
+func (rw *responseRecorder) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, if the wrapped writer allows it.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", rw.ResponseWriter)
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Status returns the written status code, or 200 if the handler never wrote one.
+func (rw *responseRecorder) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// requestOutcome classifies a finished request. Context state wins over the
+// status code: a request whose deadline passed or whose client went away is
+// reported as such even if the handler still managed to write a 200.
+func requestOutcome(ctx context.Context, rw *responseRecorder) string {
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		return outcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return outcomeCancelled
+	}
+	if rw.Status() >= http.StatusInternalServerError {
+		return outcomeError
+	}
+	return outcomeSuccess
+}
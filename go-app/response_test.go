@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorderFlushes(t *testing.T) {
+	w := httptest.NewRecorder()
+	var rw http.ResponseWriter = newResponseRecorder(w)
+
+	f, ok := rw.(http.Flusher)
+	if !ok {
+		t.Fatal("responseRecorder is not an http.Flusher")
+	}
+	f.Flush()
+	if !w.Flushed {
+		t.Error("Flush did not reach the wrapped writer")
+	}
+	if err := http.NewResponseController(rw).Flush(); err != nil {
+		t.Errorf("ResponseController.Flush: %v", err)
+	}
+}
+
+func TestResponseRecorderHijackUnsupported(t *testing.T) {
+	// httptest.ResponseRecorder cannot be hijacked
+	rw := newResponseRecorder(httptest.NewRecorder())
+	if _, _, err := rw.Hijack(); err == nil {
+		t.Error("Hijack succeeded on a writer without a connection")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// router registers handlers on a mux under a common path prefix, so the
+// service can be mounted below a subpath by a path-routing ingress.
+type router struct {
+	mux       *http.ServeMux
+	prefix    string
+	served    *routeSet // records routes that served a request, if set
+	spanNames spanNameFormat
+	redact    map[string]bool // query parameters redacted from url.* attributes
+}
+
+// newRouter returns a router for prefix, normalized to start with a slash and
+// have no trailing slash. An empty prefix mounts routes at the root.
+func newRouter(mux *http.ServeMux, prefix string) *router {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return &router{mux: mux, prefix: prefix, redact: parseQueryParamDenylist("")}
+}
+
+// Handle registers h for the prefixed pattern. The full route is stored in
+// the request context, along with the unprefixed pattern for per-endpoint
+// configuration. The server span, started before the route was known, is
+// named after it and gets it as http.route, as do the otelhttp metrics. The
+// span also gets the attributes its children inherit, like the tenant, which
+// were set before it existed.
+func (rt *router) Handle(pattern string, h http.Handler) {
+	info := routeInfo{route: rt.prefix + pattern, pattern: pattern, spanNames: rt.spanNames}
+	rt.mux.Handle(info.route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rt.served != nil {
+			rt.served.add(info.route)
+		}
+		ctx := context.WithValue(r.Context(), routeContextKey{}, info)
+		span := trace.SpanFromContext(ctx)
+		span.SetName(r.Method + " " + info.route)
+		span.SetAttributes(routeAttr(ctx))
+		span.SetAttributes(urlAttrs(r, rt.redact)...)
+		span.SetAttributes(inheritedAttributes(ctx)...)
+		if labeler, ok := otelhttp.LabelerFromContext(ctx); ok {
+			labeler.Add(routeAttr(ctx))
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+// HandleFunc registers f for the prefixed pattern.
+func (rt *router) HandleFunc(pattern string, f http.HandlerFunc) {
+	rt.Handle(pattern, f)
+}
+
+// Mount serves the unprefixed handler h under the prefixed pattern, stripping
+// the prefix first. It is for handlers that match on their own fixed paths,
+// like net/http/pprof.
+func (rt *router) Mount(pattern string, h http.Handler) {
+	rt.Handle(pattern, http.StripPrefix(rt.prefix, h))
+}
+
+type routeContextKey struct{}
+
+type routeInfo struct {
+	route     string // as served, including the route prefix
+	pattern   string // as registered, without the prefix
+	spanNames spanNameFormat
+}
+
+// routeAttr returns the http.route attribute for the route that matched the
+// request in ctx, including the route prefix.
+func routeAttr(ctx context.Context) attribute.KeyValue {
+	info, _ := ctx.Value(routeContextKey{}).(routeInfo)
+	return semconv.HTTPRoute(info.route)
+}
+
+// routePattern returns the pattern the matched route was registered with,
+// independent of ROUTE_PREFIX.
+func routePattern(ctx context.Context) string {
+	info, _ := ctx.Value(routeContextKey{}).(routeInfo)
+	return info.pattern
+}
+
+// routeSet is the set of routes that have received at least one request.
+type routeSet struct {
+	seen  sync.Map // route -> struct{}
+	count atomic.Int64
+}
+
+func (s *routeSet) add(route string) {
+	if _, loaded := s.seen.LoadOrStore(route, struct{}{}); !loaded {
+		s.count.Add(1)
+	}
+}
+
+// registerGauge reports the number of routes in s.
+func (s *routeSet) registerGauge(meter metric.Meter) error {
+	_, err := meter.Int64ObservableGauge(
+		"http.server.routes.served",
+		metric.WithDescription("Number of distinct routes that have received at least one request since startup"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(s.count.Load())
+			return nil
+		}),
+	)
+	return err
+}
+
+// spanNameFormat names server spans, set by HTTP_SPAN_NAME_FORMAT.
+type spanNameFormat string
+
+const (
+	// spanNameRoute names spans by method and route, e.g. "GET /hello".
+	spanNameRoute spanNameFormat = "route"
+	// spanNameOperation names spans by the handler's operation name, e.g.
+	// "handleRequest".
+	spanNameOperation spanNameFormat = "operation"
+)
+
+// parseSpanNameFormat parses an HTTP_SPAN_NAME_FORMAT value. An empty value
+// yields spanNameRoute.
+func parseSpanNameFormat(v string) (spanNameFormat, error) {
+	switch f := spanNameFormat(strings.ToLower(strings.TrimSpace(v))); f {
+	case "":
+		return spanNameRoute, nil
+	case spanNameRoute, spanNameOperation:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown span name format %q, want %q or %q", v, spanNameRoute, spanNameOperation)
+}
+
+// newServerHandler wraps every route in otelhttp, which starts the server
+// span from the incoming trace context and records the standard HTTP server
+// metrics. Until the router matches a route the span is named after the
+// method alone, as are requests no route matched. Spans go to the request's
+// tenant, if any; the otelhttp metrics always go to the global meter
+// provider.
+func newServerHandler(mux http.Handler) http.Handler {
+	return otelhttp.NewHandler(mux, "handleRequest",
+		otelhttp.WithTracerProvider(contextTracerProvider{}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// serverSpan returns the server span of the request in ctx. Under
+// HTTP_SPAN_NAME_FORMAT=operation it is renamed to operation, the name of
+// the handler serving it.
+func serverSpan(ctx context.Context, operation string) trace.Span {
+	span := trace.SpanFromContext(ctx)
+	if info, _ := ctx.Value(routeContextKey{}).(routeInfo); info.spanNames == spanNameOperation {
+		span.SetName(operation)
+	}
+	return span
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func serveTestRoute(t *testing.T, spanNames spanNameFormat, path string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := useTestTracerProvider(t)
+	mux := http.NewServeMux()
+	routes := newRouter(mux, "/api")
+	routes.spanNames = spanNames
+	routes.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		serverSpan(r.Context(), "ping")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	newServerHandler(mux).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(spans))
+	}
+	return spans[0]
+}
+
+func TestServerSpanNamedAfterRoute(t *testing.T) {
+	span := serveTestRoute(t, spanNameRoute, "/api/ping?x=1")
+	if span.Name() != "GET /api/ping" {
+		t.Errorf("span name = %q, want %q", span.Name(), "GET /api/ping")
+	}
+	var route attribute.Value
+	for _, kv := range span.Attributes() {
+		if kv.Key == "http.route" {
+			route = kv.Value
+		}
+	}
+	if route.AsString() != "/api/ping" {
+		t.Errorf("http.route = %q, want %q", route.AsString(), "/api/ping")
+	}
+}
+
+func TestServerSpanNamedAfterOperation(t *testing.T) {
+	if span := serveTestRoute(t, spanNameOperation, "/api/ping"); span.Name() != "ping" {
+		t.Errorf("span name = %q, want %q", span.Name(), "ping")
+	}
+}
+
+func TestServerSpanOfUnmatchedRequest(t *testing.T) {
+	if span := serveTestRoute(t, spanNameRoute, "/nowhere"); span.Name() != "GET" {
+		t.Errorf("span name = %q, want %q", span.Name(), "GET")
+	}
+}
+
+func TestServerSpanHasInheritedAttributes(t *testing.T) {
+	recorder := useTestTracerProvider(t)
+	inherit := map[attribute.Key]bool{"tenant.id": true}
+	mux := http.NewServeMux()
+	newRouter(mux, "").HandleFunc("/ping", func(http.ResponseWriter, *http.Request) {})
+	// As withTenant does, ahead of the server span
+	withInherited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := inheritAttributes(r.Context(), inherit, attribute.String("tenant.id", "acme"))
+		newServerHandler(mux).ServeHTTP(w, r.WithContext(ctx))
+	})
+	withInherited.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	for _, kv := range recorder.Ended()[0].Attributes() {
+		if kv.Key == "tenant.id" && kv.Value.AsString() == "acme" {
+			return
+		}
+	}
+	t.Error("server span has no tenant.id")
+}
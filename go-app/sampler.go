@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parseTraceSampler builds the sampler named by OTEL_TRACES_SAMPLER, with
+// arg from OTEL_TRACES_SAMPLER_ARG as the ratio of the traceidratio
+// samplers (default 1). An empty name yields parentbased_always_on.
+func parseTraceSampler(name, arg string) (sdktrace.Sampler, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	ratio := 1.0
+	if strings.HasSuffix(name, "traceidratio") && arg != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampler ratio %q", arg)
+		}
+		if ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("sampler ratio must be in [0,1], got %v", ratio)
+		}
+	}
+
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "", "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", name)
+}
+
+// Reasons a sampling override, rather than the configured sampler, decided
+// whether to sample a span.
+const (
+	overrideForceSample = "force_sample" // the request's force_sample flag
+	overrideMethodRatio = "method_ratio" // a SAMPLING_RATIO_BY_METHOD ratio
+)
+
+// samplingOverrides counts the decisions made by sampling overrides. Set in
+// main by registerSamplingOverrideCounter.
+var samplingOverrides metric.Int64Counter = noop.Int64Counter{}
+
+func registerSamplingOverrideCounter(meter metric.Meter) error {
+	counter, err := meter.Int64Counter(
+		"otel.sampler.overrides.total",
+		metric.WithDescription("Number of sampling decisions made by an override instead of the configured sampler, by reason and decision"),
+	)
+	if err != nil {
+		return err
+	}
+	samplingOverrides = counter
+	return nil
+}
+
+// recordSamplingOverride counts res as decided by the override reason.
+func recordSamplingOverride(p sdktrace.SamplingParameters, reason string, res sdktrace.SamplingResult) {
+	decision := "dropped"
+	if res.Decision == sdktrace.RecordAndSample {
+		decision = "sampled"
+	}
+	samplingOverrides.Add(p.ParentContext, 1, metric.WithAttributes(
+		attribute.String("reason", reason),
+		attribute.String("decision", decision),
+	))
+}
+
+// countingSampler wraps a sampler and counts its sampled and dropped
+// decisions, so the effective sampling ratio (after parent-based decisions
+// and overrides) can be charted rather than inferred from configuration.
+type countingSampler struct {
+	next    sdktrace.Sampler
+	sampled metric.Int64Counter
+	dropped metric.Int64Counter
+}
+
+var _ sdktrace.Sampler = (*countingSampler)(nil)
+
+// newCountingSampler wraps next. The counters are created on the global meter
+// provider, which delegates to the SDK provider once it is installed.
+func newCountingSampler(next sdktrace.Sampler) (sdktrace.Sampler, error) {
+	meter := appMeter("go-sample-app/sampler")
+	sampled, err := meter.Int64Counter(
+		"otel.sampler.sampled.total",
+		metric.WithDescription("Number of spans the sampler decided to record and sample"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64Counter(
+		"otel.sampler.dropped.total",
+		metric.WithDescription("Number of spans the sampler decided not to sample"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &countingSampler{next: next, sampled: sampled, dropped: dropped}, nil
+}
+
+func (s *countingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.next.ShouldSample(p)
+	if res.Decision == sdktrace.RecordAndSample {
+		s.sampled.Add(p.ParentContext, 1)
+	} else {
+		s.dropped.Add(p.ParentContext, 1)
+	}
+	return res
+}
+
+func (s *countingSampler) Description() string {
+	return "Counting{" + s.next.Description() + "}"
+}
+
+// tracestateSampler adds a vendor entry to the tracestate of every span it
+// samples, on top of whatever the parent carried. Spans that are not sampled
+// keep the parent's tracestate as is. The SDK copies the result's tracestate
+// into the span context, so the entry is exported with the span and, through
+// the W3C trace context propagator installed in initTracer, sent on outbound
+// calls.
+type tracestateSampler struct {
+	next  sdktrace.Sampler
+	key   string
+	value string
+}
+
+var _ sdktrace.Sampler = (*tracestateSampler)(nil)
+
+// newTracestateSampler wraps next with the vendor entry given as key=value.
+func newTracestateSampler(next sdktrace.Sampler, entry string) (sdktrace.Sampler, error) {
+	key, value, ok := strings.Cut(entry, "=")
+	if !ok {
+		return nil, fmt.Errorf("tracestate entry %q is not in key=value form", entry)
+	}
+	if _, err := (trace.TraceState{}).Insert(key, value); err != nil {
+		return nil, fmt.Errorf("invalid tracestate entry %q: %w", entry, err)
+	}
+	return &tracestateSampler{next: next, key: key, value: value}, nil
+}
+
+func (s *tracestateSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.next.ShouldSample(p)
+	if res.Decision != sdktrace.RecordAndSample {
+		return res
+	}
+	// Insert moves the entry to the front, as W3C requires for a mutated key.
+	if ts, err := res.Tracestate.Insert(s.key, s.value); err == nil {
+		res.Tracestate = ts
+	}
+	return res
+}
+
+func (s *tracestateSampler) Description() string {
+	return "Tracestate{" + s.next.Description() + "}"
+}
+
+// methodSampler samples new traces whose root span carries an http.method
+// attribute at the ratio configured for that method. Spans with a parent, and
+// roots of methods without a ratio, are left to next.
+type methodSampler struct {
+	next   sdktrace.Sampler
+	ratios map[string]sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = (*methodSampler)(nil)
+
+// newMethodSampler wraps next with per-method ratios parsed from a
+// comma-separated METHOD:ratio list, e.g. "POST:1.0,GET:0.1".
+func newMethodSampler(next sdktrace.Sampler, v string) (sdktrace.Sampler, error) {
+	s := &methodSampler{next: next, ratios: map[string]sdktrace.Sampler{}}
+	for _, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		method, ratio, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("method ratio %q is not in METHOD:ratio form", pair)
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(ratio), 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("ratio for %s must be in [0,1], got %q", method, ratio)
+		}
+		s.ratios[strings.ToUpper(strings.TrimSpace(method))] = sdktrace.TraceIDRatioBased(r)
+	}
+	return s, nil
+}
+
+func (s *methodSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		return s.next.ShouldSample(p)
+	}
+	for _, attr := range p.Attributes {
+		if attr.Key != semconv.HTTPMethodKey {
+			continue
+		}
+		if ratio, ok := s.ratios[attr.Value.AsString()]; ok {
+			res := ratio.ShouldSample(p)
+			recordSamplingOverride(p, overrideMethodRatio, res)
+			return res
+		}
+		break
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s *methodSampler) Description() string {
+	return "MethodSampler{" + s.next.Description() + "}"
+}
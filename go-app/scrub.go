@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// defaultScrubPatterns match the PII and secrets most likely to end up in a
+// log field or span attribute by accident.
+var defaultScrubPatterns = []string{
+	// Email addresses
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	// Bearer tokens and JWTs
+	`(?i)bearer\s+[A-Za-z0-9._~+/-]+=*`,
+	`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	// Credit-card-like numbers: 13 to 19 digits, optionally space or dash separated
+	`\b(?:\d[ -]?){12,18}\d\b`,
+}
+
+// scrubber redacts substrings matching any of its patterns.
+type scrubber struct {
+	patterns []*regexp.Regexp
+}
+
+// newScrubber compiles patterns into a scrubber. An empty list yields a
+// scrubber that leaves values untouched.
+func newScrubber(patterns []string) (*scrubber, error) {
+	s := &scrubber{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrub pattern %q: %w", p, err)
+		}
+		s.patterns = append(s.patterns, re)
+	}
+	return s, nil
+}
+
+// parseScrubPatterns splits a comma-separated SCRUB_PATTERNS value. Use \x2c
+// for a literal comma inside a pattern.
+func parseScrubPatterns(v string) []string {
+	if v == "" {
+		return defaultScrubPatterns
+	}
+	var patterns []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func (s *scrubber) Scrub(v string) string {
+	for _, re := range s.patterns {
+		v = re.ReplaceAllString(v, redacted)
+	}
+	return v
+}
+
+func (s *scrubber) scrubAttrs(attrs []attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			kv = kv.Key.String(s.Scrub(kv.Value.AsString()))
+		case attribute.STRINGSLICE:
+			vals := kv.Value.AsStringSlice()
+			for j := range vals {
+				vals[j] = s.Scrub(vals[j])
+			}
+			kv = kv.Key.StringSlice(vals)
+		}
+		out[i] = kv
+	}
+	return out
+}
+
+func (s *scrubber) scrubFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = s.Scrub(f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s.Scrub(err.Error())}
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// scrubCore redacts the message and string fields of every entry before
+// handing it to the wrapped core.
+type scrubCore struct {
+	zapcore.Core
+	s *scrubber
+}
+
+func newScrubCore(core zapcore.Core, s *scrubber) zapcore.Core {
+	return &scrubCore{Core: core, s: s}
+}
+
+func (c *scrubCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scrubCore{Core: c.Core.With(c.s.scrubFields(fields)), s: c.s}
+}
+
+func (c *scrubCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *scrubCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.s.Scrub(ent.Message)
+	return c.Core.Write(ent, c.s.scrubFields(fields))
+}
+
+// scrubProcessor redacts span and event attributes before passing ended spans
+// on to the next processor, typically the exporting batch processor.
+type scrubProcessor struct {
+	next sdktrace.SpanProcessor
+	s    *scrubber
+}
+
+var _ sdktrace.SpanProcessor = (*scrubProcessor)(nil)
+
+func newScrubProcessor(next sdktrace.SpanProcessor, s *scrubber) sdktrace.SpanProcessor {
+	return &scrubProcessor{next: next, s: s}
+}
+
+func (p *scrubProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *scrubProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(&scrubbedSpan{ReadOnlySpan: s, s: p.s})
+}
+
+func (p *scrubProcessor) Shutdown(ctx context.Context) error   { return p.next.Shutdown(ctx) }
+func (p *scrubProcessor) ForceFlush(ctx context.Context) error { return p.next.ForceFlush(ctx) }
+
+// scrubbedSpan is a read-only view of a span with its attributes redacted.
+type scrubbedSpan struct {
+	sdktrace.ReadOnlySpan
+	s *scrubber
+}
+
+func (s *scrubbedSpan) Attributes() []attribute.KeyValue {
+	return s.s.scrubAttrs(s.ReadOnlySpan.Attributes())
+}
+
+func (s *scrubbedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	out := make([]sdktrace.Event, len(events))
+	for i, e := range events {
+		e.Attributes = s.s.scrubAttrs(e.Attributes)
+		out[i] = e
+	}
+	return out
+}
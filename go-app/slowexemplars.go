@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exemplarContext returns the context to record a request duration d with.
+// Durations below threshold offer no exemplar, so exemplars point at the
+// slow, interesting traces.
+// The SDK has no pluggable exemplar filter, but its trace_based filter only
+// keeps measurements made in a sampled span, so a fast request's duration is
+// recorded with the span hidden from it.
+func exemplarContext(ctx context.Context, d, threshold time.Duration) context.Context {
+	if d >= threshold {
+		return ctx
+	}
+	return trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+}
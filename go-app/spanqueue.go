@@ -0,0 +1,185 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type queuedSpanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+type queuedSpan struct {
+	key      queuedSpanKey
+	enqueued time.Time
+}
+
+// spanQueueTracker timestamps spans as they are handed to the batch span
+// processor of one tracer provider and forgets them once they are exported, so it can tell how
+// long the oldest span has been waiting. The queue is FIFO, so when a batch
+// is exported any span enqueued before its newest span and not part of an
+// export was dropped by the full queue; it is forgotten too, and counted in
+// otel.bsp.dropped_spans.total.
+type spanQueueTracker struct {
+	mu    sync.Mutex
+	order *list.List // of *queuedSpan, oldest first
+	spans map[queuedSpanKey]*list.Element
+
+	// dropped counts spans dropped by the full queue. Set by
+	// registerInstruments.
+	dropped metric.Int64Counter
+}
+
+func newSpanQueueTracker() *spanQueueTracker {
+	return &spanQueueTracker{
+		order:   list.New(),
+		spans:   make(map[queuedSpanKey]*list.Element),
+		dropped: noop.Int64Counter{},
+	}
+}
+
+func (t *spanQueueTracker) enqueue(sc trace.SpanContext) {
+	key := queuedSpanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans[key] = t.order.PushBack(&queuedSpan{key: key, enqueued: time.Now()})
+}
+
+func (t *spanQueueTracker) exported(spans []sdktrace.ReadOnlySpan) {
+	t.mu.Lock()
+	dropped, counter := t.forget(spans), t.dropped
+	t.mu.Unlock()
+	if dropped > 0 {
+		counter.Add(context.Background(), int64(dropped))
+	}
+}
+
+// forget removes the exported spans and those the queue dropped before them,
+// returning how many were dropped. t.mu must be held.
+func (t *spanQueueTracker) forget(spans []sdktrace.ReadOnlySpan) (dropped int) {
+
+	var newest time.Time
+	for _, s := range spans {
+		key := queuedSpanKey{traceID: s.SpanContext().TraceID(), spanID: s.SpanContext().SpanID()}
+		if el, ok := t.spans[key]; ok {
+			if qs := el.Value.(*queuedSpan); qs.enqueued.After(newest) {
+				newest = qs.enqueued
+			}
+			t.order.Remove(el)
+			delete(t.spans, key)
+		}
+	}
+
+	for el := t.order.Front(); el != nil; el = t.order.Front() {
+		qs := el.Value.(*queuedSpan)
+		if qs.enqueued.After(newest) {
+			break
+		}
+		t.order.Remove(el)
+		delete(t.spans, qs.key)
+		dropped++
+	}
+	return dropped
+}
+
+// stats returns the number of queued spans and the age of the oldest.
+func (t *spanQueueTracker) stats() (int, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	front := t.order.Front()
+	if front == nil {
+		return 0, 0
+	}
+	return t.order.Len(), time.Since(front.Value.(*queuedSpan).enqueued)
+}
+
+// registerInstruments reports otel.bsp.queue.size and
+// otel.bsp.queue.oldest_span_age, and counts otel.bsp.dropped_spans.total. A
+// growing age with a steady size means spans are being held back before
+// export.
+func (t *spanQueueTracker) registerInstruments(meter metric.Meter) error {
+	dropped, err := meter.Int64Counter(
+		"otel.bsp.dropped_spans.total",
+		metric.WithDescription("Number of spans dropped because the batch span processor queue was full"),
+	)
+	if err != nil {
+		return err
+	}
+	size, err := meter.Int64ObservableGauge(
+		"otel.bsp.queue.size",
+		metric.WithDescription("Number of spans waiting in batch span processor queues"),
+	)
+	if err != nil {
+		return err
+	}
+	age, err := meter.Float64ObservableGauge(
+		"otel.bsp.queue.oldest_span_age",
+		metric.WithDescription("How long the oldest span waiting in a batch span processor queue has waited"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		n, oldest := t.stats()
+		o.ObserveInt64(size, int64(n))
+		o.ObserveFloat64(age, toMillis(oldest))
+		return nil
+	}, size, age)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.dropped = dropped
+	t.mu.Unlock()
+	return nil
+}
+
+// queueTrackingProcessor wraps a batch span processor, timestamping the
+// spans it will queue. Like the batch span processor, it ignores spans that
+// are not sampled.
+type queueTrackingProcessor struct {
+	sdktrace.SpanProcessor
+	t *spanQueueTracker
+
+	// Held across both enqueues, so spans ending concurrently reach the
+	// tracker in the order they reach the queue and none is mistaken for
+	// dropped. The batch span processor's OnEnd never blocks.
+	mu sync.Mutex
+}
+
+var _ sdktrace.SpanProcessor = (*queueTrackingProcessor)(nil)
+
+func (p *queueTrackingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.t.enqueue(s.SpanContext())
+	p.SpanProcessor.OnEnd(s)
+}
+
+// queueTrackingExporter forgets spans once the batch span processor hands
+// them to the exporter, whether or not the export succeeds.
+type queueTrackingExporter struct {
+	sdktrace.SpanExporter
+	t *spanQueueTracker
+}
+
+var _ sdktrace.SpanExporter = (*queueTrackingExporter)(nil)
+
+func (e *queueTrackingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.t.exported(spans)
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
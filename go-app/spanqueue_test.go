@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanQueueTrackerCountsDroppedSpans(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = mp.Shutdown(context.Background()) })
+	tracker := newSpanQueueTracker()
+	if err := tracker.registerInstruments(mp.Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	var spans []sdktrace.ReadOnlySpan
+	for i := byte(1); i <= 3; i++ {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{i},
+			SpanID:     trace.SpanID{i},
+			TraceFlags: trace.FlagsSampled,
+		})
+		tracker.enqueue(sc)
+		spans = append(spans, tracetest.SpanStub{SpanContext: sc}.Snapshot())
+	}
+	// The first two never reached the exporter, so the full queue dropped them
+	tracker.exported(spans[2:])
+
+	if n, _ := tracker.stats(); n != 0 {
+		t.Errorf("%d spans still queued, want 0", n)
+	}
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "otel.bsp.dropped_spans.total" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 2 {
+				t.Errorf("otel.bsp.dropped_spans.total = %#v, want 2 spans", m.Data)
+			}
+			return
+		}
+	}
+	t.Fatal("otel.bsp.dropped_spans.total not recorded")
+}
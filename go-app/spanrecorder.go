@@ -0,0 +1,193 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Default bounds of the in-memory span recorder.
+const (
+	defaultRecorderMaxTraces = 1000
+	defaultRecorderMaxBytes  = 16 << 20
+)
+
+// recordedSpanOverhead approximates the memory taken by a recordedSpan beyond
+// its name, used to enforce the recorder's byte budget.
+const recordedSpanOverhead = 64
+
+// recordedSpan is the subset of an ended span kept in memory for the debug
+// endpoints.
+type recordedSpan struct {
+	Name     string
+	TraceID  trace.TraceID
+	Duration time.Duration
+}
+
+func (s recordedSpan) size() int {
+	return len(s.Name) + recordedSpanOverhead
+}
+
+// recordedTrace groups the recorded spans of one trace.
+type recordedTrace struct {
+	id    trace.TraceID
+	spans []recordedSpan
+	bytes int
+}
+
+// spanRecorder is a span processor that keeps the spans of the most recent
+// traces in memory. When either the trace count or the approximate byte
+// budget is exceeded, whole traces are evicted oldest first. It never exports
+// anything; it only backs the /debug endpoints so developers can inspect
+// recent activity without Tempo.
+type spanRecorder struct {
+	maxTraces int
+	maxBytes  int
+
+	mu     sync.Mutex
+	order  *list.List // of *recordedTrace, oldest at the front
+	traces map[trace.TraceID]*list.Element
+	bytes  int
+}
+
+var _ sdktrace.SpanProcessor = (*spanRecorder)(nil)
+
+func newSpanRecorder(maxTraces, maxBytes int) *spanRecorder {
+	if maxTraces <= 0 {
+		maxTraces = defaultRecorderMaxTraces
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultRecorderMaxBytes
+	}
+	return &spanRecorder{
+		maxTraces: maxTraces,
+		maxBytes:  maxBytes,
+		order:     list.New(),
+		traces:    make(map[trace.TraceID]*list.Element),
+	}
+}
+
+func (r *spanRecorder) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (r *spanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	rec := recordedSpan{
+		Name:     s.Name(),
+		TraceID:  s.SpanContext().TraceID(),
+		Duration: s.EndTime().Sub(s.StartTime()),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	el, ok := r.traces[rec.TraceID]
+	if !ok {
+		el = r.order.PushBack(&recordedTrace{id: rec.TraceID})
+		r.traces[rec.TraceID] = el
+	}
+	t := el.Value.(*recordedTrace)
+	t.spans = append(t.spans, rec)
+	t.bytes += rec.size()
+	r.bytes += rec.size()
+
+	// A trace over the byte budget on its own goes too, once it is the
+	// oldest; its later spans start a new, smaller one
+	for r.order.Len() > r.maxTraces || r.bytes > r.maxBytes {
+		r.evictOldestLocked()
+	}
+}
+
+func (r *spanRecorder) evictOldestLocked() {
+	oldest := r.order.Front()
+	t := r.order.Remove(oldest).(*recordedTrace)
+	delete(r.traces, t.id)
+	r.bytes -= t.bytes
+}
+
+func (r *spanRecorder) Shutdown(context.Context) error   { return nil }
+func (r *spanRecorder) ForceFlush(context.Context) error { return nil }
+
+// TraceCount returns the number of traces currently retained.
+func (r *spanRecorder) TraceCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.order.Len()
+}
+
+// Snapshot returns a copy of the recorded spans, oldest trace first.
+func (r *spanRecorder) Snapshot() []recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []recordedSpan
+	for el := r.order.Front(); el != nil; el = el.Next() {
+		out = append(out, el.Value.(*recordedTrace).spans...)
+	}
+	return out
+}
+
+// registerTraceCountGauge exposes the number of retained traces as
+// debug.recorder.traces.
+func (r *spanRecorder) registerTraceCountGauge() error {
+	_, err := appMeter("go-sample-app/debug").Int64ObservableGauge(
+		"debug.recorder.traces",
+		metric.WithDescription("Number of traces retained by the in-memory span recorder"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(r.TraceCount()))
+			return nil
+		}),
+	)
+	return err
+}
+
+// spanStat summarizes the durations of all recorded spans sharing a name.
+type spanStat struct {
+	Name  string  `json:"name"`
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+// Stats aggregates the recorded spans by name, sorted by name.
+func (r *spanRecorder) Stats() []spanStat {
+	byName := make(map[string][]time.Duration)
+	for _, s := range r.Snapshot() {
+		byName[s.Name] = append(byName[s.Name], s.Duration)
+	}
+
+	stats := make([]spanStat, 0, len(byName))
+	for name, durations := range byName {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		stats = append(stats, spanStat{
+			Name:  name,
+			Count: len(durations),
+			P50Ms: toMillis(percentile(durations, 0.50)),
+			P95Ms: toMillis(percentile(durations, 0.95)),
+			MaxMs: toMillis(durations[len(durations)-1]),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
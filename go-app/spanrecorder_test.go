@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recorderTestSpan(traceID byte, name string) tracetest.SpanStub {
+	return tracetest.SpanStub{
+		Name: name,
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{traceID},
+			SpanID:  trace.SpanID{1},
+		}),
+	}
+}
+
+func TestSpanRecorderEvictsOversizeTrace(t *testing.T) {
+	r := newSpanRecorder(10, 1024)
+	r.OnEnd(recorderTestSpan(1, "small").Snapshot())
+	r.OnEnd(recorderTestSpan(2, strings.Repeat("x", 2048)).Snapshot())
+
+	if n := r.TraceCount(); n != 0 {
+		t.Errorf("TraceCount = %d, want 0", n)
+	}
+	if r.bytes != 0 {
+		t.Errorf("bytes = %d, want 0", r.bytes)
+	}
+}
+
+func TestSpanRecorderEvictsOldestTrace(t *testing.T) {
+	r := newSpanRecorder(2, 1<<20)
+	for id := byte(1); id <= 3; id++ {
+		r.OnEnd(recorderTestSpan(id, "span").Snapshot())
+	}
+
+	spans := r.Snapshot()
+	if len(spans) != 2 || spans[0].TraceID != (trace.TraceID{2}) || spans[1].TraceID != (trace.TraceID{3}) {
+		t.Errorf("Snapshot = %v, want the spans of traces 2 and 3", spans)
+	}
+}
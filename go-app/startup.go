@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startupRetry retries a startup step, such as creating the exporters, so a
+// collector that is still coming up doesn't put the container into a crash
+// loop.
+type startupRetry struct {
+	attempts  int
+	baseDelay time.Duration
+}
+
+// do calls fn until it succeeds or the attempts run out, doubling the delay
+// after every failure, and returns the last error.
+func (s startupRetry) do(logger *zap.Logger, step string, fn func() error) error {
+	delay := s.baseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= s.attempts {
+			return err
+		}
+		logger.Warn("startup step failed, retrying",
+			zap.String("step", step),
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", s.attempts),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// collectorWaitInterval is how often waitFor checks the collector again.
+const collectorWaitInterval = time.Second
+
+// waitFor blocks until dep is up or timeout passes, so telemetry emitted
+// right after startup isn't lost to a collector that isn't there yet. It
+// returns the last check error on timeout.
+func waitFor(ctx context.Context, logger *zap.Logger, dep dependency, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		checkCtx, cancelCheck := context.WithTimeout(ctx, collectorWaitInterval)
+		err := dep.check(checkCtx)
+		cancelCheck()
+		if err == nil {
+			return nil
+		}
+		logger.Info("waiting for dependency",
+			zap.String("dependency", dep.name),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %s: %w", timeout, err)
+		case <-time.After(collectorWaitInterval):
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// parseAttributeKeys parses a comma-separated list of attribute keys.
+func parseAttributeKeys(v string) map[attribute.Key]bool {
+	keys := map[attribute.Key]bool{}
+	for _, k := range strings.Split(v, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys[attribute.Key(k)] = true
+		}
+	}
+	return keys
+}
+
+func stripAttrs(attrs []attribute.KeyValue, keys map[attribute.Key]bool) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if !keys[kv.Key] {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// stripProcessor removes attributes from span and event attributes before
+// passing ended spans to the export processor, to cut export bandwidth.
+type stripProcessor struct {
+	next sdktrace.SpanProcessor
+	keys map[attribute.Key]bool
+}
+
+var _ sdktrace.SpanProcessor = (*stripProcessor)(nil)
+
+func newStripProcessor(next sdktrace.SpanProcessor, keys map[attribute.Key]bool) sdktrace.SpanProcessor {
+	return &stripProcessor{next: next, keys: keys}
+}
+
+func (p *stripProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *stripProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(&strippedSpan{ReadOnlySpan: s, keys: p.keys})
+}
+
+func (p *stripProcessor) Shutdown(ctx context.Context) error   { return p.next.Shutdown(ctx) }
+func (p *stripProcessor) ForceFlush(ctx context.Context) error { return p.next.ForceFlush(ctx) }
+
+// strippedSpan is a read-only view of a span without the stripped attributes.
+type strippedSpan struct {
+	sdktrace.ReadOnlySpan
+	keys map[attribute.Key]bool
+}
+
+func (s *strippedSpan) Attributes() []attribute.KeyValue {
+	return stripAttrs(s.ReadOnlySpan.Attributes(), s.keys)
+}
+
+func (s *strippedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	out := make([]sdktrace.Event, len(events))
+	for i, e := range events {
+		e.Attributes = stripAttrs(e.Attributes, s.keys)
+		out[i] = e
+	}
+	return out
+}
+
+// stripAttributesView returns a single view that applies the first of views
+// matching an instrument, then removes keys from its attributes. It replaces
+// views rather than adding to them, since every view matching an instrument
+// would otherwise export it as a separate stream.
+func stripAttributesView(keys map[attribute.Key]bool, views ...sdkmetric.View) sdkmetric.View {
+	filter := func(kv attribute.KeyValue) bool { return !keys[kv.Key] }
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		for _, v := range views {
+			if stream, ok := v(inst); ok {
+				if prev := stream.AttributeFilter; prev != nil {
+					stream.AttributeFilter = func(kv attribute.KeyValue) bool { return prev(kv) && filter(kv) }
+				} else {
+					stream.AttributeFilter = filter
+				}
+				return stream, true
+			}
+		}
+		return sdkmetric.Stream{
+			Name:            inst.Name,
+			Description:     inst.Description,
+			Unit:            inst.Unit,
+			AttributeFilter: filter,
+		}, true
+	}
+}
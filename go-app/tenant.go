@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.uber.org/zap"
+)
+
+// tenantOrgIDHeader is the header Mimir, Tempo and Loki use to select the
+// tenant a write belongs to.
+const tenantOrgIDHeader = "X-Scope-OrgID"
+
+// validTenant restricts tenant IDs to something safe to use as a map key and
+// an outgoing header value.
+var validTenant = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// tenantShutdownTimeout bounds the flush and shutdown of one tenant's
+// providers once they are retired.
+const tenantShutdownTimeout = 10 * time.Second
+
+// errTenantBacklog is returned for a new tenant while too many retired
+// providers are still waiting to be shut down.
+var errTenantBacklog = errors.New("too many tenant providers waiting to shut down")
+
+// tenantProviders holds the tracer and meter provider for one tenant, and
+// the request metrics created from the latter.
+type tenantProviders struct {
+	tp      *sdktrace.TracerProvider
+	mp      *sdkmetric.MeterProvider
+	metrics *requestMetrics
+
+	// Holds the tenant's metrics when they are scraped rather than pushed
+	promRegistry *prometheus.Registry
+
+	// Guarded by the registry's mu
+	lastUsed time.Time
+	refs     int  // requests using the providers
+	retired  bool // removed from the registry, shut down once refs is 0
+}
+
+func (p *tenantProviders) shutdown(ctx context.Context) {
+	if err := p.tp.Shutdown(ctx); err != nil {
+		zap.L().Named(loggerOTel).Error("Error shutting down tenant tracer provider", zap.Error(err))
+	}
+	if err := shutdownMeterProvider(ctx, p.mp); err != nil {
+		zap.L().Named(loggerOTel).Error("Error shutting down tenant meter provider", zap.Error(err))
+	}
+	instruments.forget(p.mp)
+}
+
+// tenantRegistry lazily creates one tracer/meter provider pair per tenant so
+// each tenant's telemetry is exported to its own backend. The number of live
+// providers is bounded; the least recently used one is evicted when the
+// bound is hit and idle ones are retired in the background. Providers are
+// reference counted by the requests using them, and a retired pair is shut
+// down by run, one at a time, once its last request is done.
+type tenantRegistry struct {
+	res          *resource.Resource
+	target       *otlpTarget
+	endpoints    map[string]string
+	sampler      sdktrace.Sampler
+	scrub        *scrubber
+	processors   []sdktrace.SpanProcessor
+	views        []sdkmetric.View
+	cfg          Config
+	maxProviders int
+	idleTimeout  time.Duration
+
+	mu        sync.Mutex
+	providers map[string]*tenantProviders
+	retiring  int                // retired, not yet shut down
+	shutdowns []*tenantProviders // retired and unused, for run to shut down
+	wake      chan struct{}      // signals run that shutdowns is not empty
+}
+
+// newTenantRegistry returns a registry whose providers export to targets
+// derived from target, the main one, so they keep its headers and follow
+// its reloads; tenants in cfg.Tenant.Endpoints swap in their own endpoint.
+// At most cfg.Tenant.MaxProviders tenants have providers at once. Its tracer providers use the span processors of the main
+// provider as well as their own export pipeline. The processors stay owned
+// by the main provider: tenant providers never shut them down. Metrics are
+// pushed every cfg.MetricInterval, or with cfg.MetricsExporter set to
+// prometheus left for Gather to collect.
+func newTenantRegistry(res *resource.Resource, target *otlpTarget, sampler sdktrace.Sampler, scrub *scrubber, processors []sdktrace.SpanProcessor, views []sdkmetric.View, cfg Config) *tenantRegistry {
+	maxProviders, idleTimeout := cfg.Tenant.MaxProviders, cfg.Tenant.IdleTimeout
+	if maxProviders < 1 {
+		maxProviders = 1
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = 5 * time.Minute
+	}
+	shared := make([]sdktrace.SpanProcessor, len(processors))
+	for i, p := range processors {
+		shared[i] = sharedSpanProcessor{p}
+	}
+	return &tenantRegistry{
+		res:          res,
+		target:       target,
+		endpoints:    cfg.Tenant.Endpoints,
+		sampler:      sampler,
+		scrub:        scrub,
+		processors:   shared,
+		views:        views,
+		cfg:          cfg,
+		maxProviders: maxProviders,
+		idleTimeout:  idleTimeout,
+		providers:    make(map[string]*tenantProviders),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// sharedSpanProcessor is a span processor of the main tracer provider used
+// by a tenant's as well. Shutting the tenant's provider down must not shut
+// it down.
+type sharedSpanProcessor struct {
+	sdktrace.SpanProcessor
+}
+
+func (sharedSpanProcessor) Shutdown(context.Context) error { return nil }
+
+// parseTenantEndpoints parses TENANT_ENDPOINTS, a comma-separated list of
+// tenant=host:port pairs.
+func parseTenantEndpoints(v string) map[string]string {
+	endpoints := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		tenant, endpoint, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && validTenant.MatchString(tenant) && endpoint != "" {
+			endpoints[tenant] = endpoint
+		}
+	}
+	return endpoints
+}
+
+// acquire returns the providers for tenant, creating them if needed. The
+// caller must release them when done.
+func (r *tenantRegistry) acquire(ctx context.Context, tenant string) (*tenantProviders, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.providers[tenant]; ok {
+		p.lastUsed = time.Now()
+		p.refs++
+		return p, nil
+	}
+
+	// Retired providers still hold their exporters until they are shut down
+	if r.retiring >= r.maxProviders {
+		return nil, errTenantBacklog
+	}
+	if len(r.providers) >= r.maxProviders {
+		r.evictOldestLocked()
+	}
+
+	// Unless the tenant has its own, the main endpoint, as reloaded
+	target := r.target.derive(r.endpoints[tenant], map[string]string{tenantOrgIDHeader: tenant})
+
+	// Scraped like the main provider's metrics, told apart by a tenant_id
+	// label, instead of pushed
+	metricsTarget := target
+	var readers []sdkmetric.Reader
+	var promRegistry *prometheus.Registry
+	if r.cfg.MetricsExporter == metricsExporterPrometheus {
+		promRegistry = prometheus.NewRegistry()
+		promExp, err := otelprometheus.New(otelprometheus.WithRegisterer(
+			prometheus.WrapRegistererWith(prometheus.Labels{"tenant_id": tenant}, promRegistry),
+		))
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, promExp)
+		metricsTarget = nil
+	}
+	mp, err := newMeterProvider(ctx, r.res, metricsTarget, r.cfg.MetricInterval, readers, r.views...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Spans the tenant's backend drops are counted with its own metrics
+	spanQueue := newSpanQueueTracker()
+	tp, err := newTracerProvider(ctx, r.cfg, r.res, target, instruments.Meter(mp, "go-sample-app/exporter"), r.sampler, r.scrub, spanQueue, r.processors...)
+	if err != nil {
+		_ = mp.Shutdown(ctx)
+		return nil, err
+	}
+	metrics, err := newRequestMetrics(instruments.Meter(mp, "http-server"))
+	if err == nil {
+		// Reported to the tenant's own backend, like the rest of its metrics
+		err = target.failures.registerGauge(instruments.Meter(mp, "go-sample-app/exporter"))
+	}
+	if err == nil {
+		err = spanQueue.registerInstruments(instruments.Meter(mp, "go-sample-app/trace"))
+	}
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		_ = mp.Shutdown(ctx)
+		return nil, err
+	}
+
+	p := &tenantProviders{tp: tp, mp: mp, metrics: metrics, promRegistry: promRegistry, lastUsed: time.Now(), refs: 1}
+	r.providers[tenant] = p
+	zap.L().Named(loggerOTel).Info("created tenant telemetry providers",
+		zap.String("tenant", tenant),
+		zap.String("endpoint", target.Endpoint()),
+	)
+	return p, nil
+}
+
+// release gives back providers returned by acquire.
+func (r *tenantRegistry) release(p *tenantProviders) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.refs--
+	if p.retired && p.refs == 0 {
+		r.queueShutdownLocked(p)
+	}
+}
+
+func (r *tenantRegistry) evictOldestLocked() {
+	var oldest string
+	for tenant, p := range r.providers {
+		if oldest == "" || p.lastUsed.Before(r.providers[oldest].lastUsed) {
+			oldest = tenant
+		}
+	}
+	if _, ok := r.providers[oldest]; ok {
+		r.retireLocked(oldest)
+	}
+}
+
+// retireLocked removes the providers of tenant from the registry. They are
+// shut down once no request uses them any more.
+func (r *tenantRegistry) retireLocked(tenant string) {
+	p := r.providers[tenant]
+	delete(r.providers, tenant)
+	p.retired = true
+	r.retiring++
+	if p.refs == 0 {
+		r.queueShutdownLocked(p)
+	}
+}
+
+func (r *tenantRegistry) queueShutdownLocked(p *tenantProviders) {
+	r.shutdowns = append(r.shutdowns, p)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run retires providers that have been idle longer than idleTimeout and
+// shuts down retired ones, each within tenantShutdownTimeout, until ctx is
+// done. Shutting them down here rather than where they are retired keeps a
+// slow flush from stalling requests, and keeps it to one at a time.
+func (r *tenantRegistry) run(ctx context.Context) {
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			for tenant, p := range r.providers {
+				if p.refs == 0 && now.Sub(p.lastUsed) > r.idleTimeout {
+					r.retireLocked(tenant)
+				}
+			}
+			r.mu.Unlock()
+		case <-r.wake:
+			for {
+				r.mu.Lock()
+				if len(r.shutdowns) == 0 {
+					r.mu.Unlock()
+					break
+				}
+				p := r.shutdowns[0]
+				r.shutdowns = r.shutdowns[1:]
+				r.mu.Unlock()
+
+				shutdownCtx, cancel := context.WithTimeout(ctx, tenantShutdownTimeout)
+				p.shutdown(shutdownCtx)
+				cancel()
+
+				r.mu.Lock()
+				r.retiring--
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Shutdown flushes and shuts down every tenant's providers, including
+// retired ones still waiting for run. It expects no request to be using
+// them any more.
+func (r *tenantRegistry) Shutdown(ctx context.Context) {
+	r.mu.Lock()
+	var providers []*tenantProviders
+	for _, p := range r.providers {
+		providers = append(providers, p)
+	}
+	providers = append(providers, r.shutdowns...)
+	r.providers = make(map[string]*tenantProviders)
+	r.shutdowns = nil
+	r.mu.Unlock()
+
+	for _, p := range providers {
+		p.shutdown(ctx)
+	}
+}
+
+// Gather collects the metrics of the live tenants for a Prometheus scrape,
+// when they are scraped rather than pushed. Retired tenants drop out of the
+// scrape straight away.
+func (r *tenantRegistry) Gather() ([]*dto.MetricFamily, error) {
+	r.mu.Lock()
+	var gatherers prometheus.Gatherers
+	for _, p := range r.providers {
+		if p.promRegistry != nil {
+			gatherers = append(gatherers, p.promRegistry)
+		}
+	}
+	r.mu.Unlock()
+	return gatherers.Gather()
+}
+
+type tenantContextKey struct{}
+
+// withTenant routes a request's telemetry to the providers of the tenant named
+// in header. Requests without a valid tenant use the global providers.
+func withTenant(reg *tenantRegistry, header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get(header)
+		if validTenant.MatchString(tenant) {
+			p, err := reg.acquire(r.Context(), tenant)
+			if err != nil {
+				zap.L().Named(loggerOTel).Error("failed to create tenant telemetry providers",
+					zap.String("tenant", tenant),
+					zap.Error(err),
+				)
+			} else {
+				// Spans end and metrics are recorded before the handler
+				// returns, so the providers are no longer needed after it
+				defer reg.release(p)
+				ctx := context.WithValue(r.Context(), tenantContextKey{}, p)
+				r = r.WithContext(inheritAttributes(ctx, reg.cfg.InheritedSpanAttributes, attribute.String("tenant.id", tenant)))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tracerProvider returns the tenant's tracer provider stored in ctx, or the
+// global one.
+func tracerProvider(ctx context.Context) trace.TracerProvider {
+	if p, ok := ctx.Value(tenantContextKey{}).(*tenantProviders); ok {
+		return p.tp
+	}
+	return otel.GetTracerProvider()
+}
+
+// contextTracerProvider hands out tracers that start each span on
+// tracerProvider(ctx), so instrumentation set up once at startup, like
+// otelhttp, still follows the tenant of each request.
+type contextTracerProvider struct {
+	embedded.TracerProvider
+}
+
+var _ trace.TracerProvider = contextTracerProvider{}
+
+func (contextTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return contextTracer{name: name, opts: opts}
+}
+
+type contextTracer struct {
+	embedded.Tracer
+	name string
+	opts []trace.TracerOption
+}
+
+func (t contextTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracerProvider(ctx).Tracer(t.name, t.opts...).Start(ctx, spanName, opts...)
+}
+
+// requestMetricsFor returns the tenant's request metrics stored in ctx, or
+// def.
+func requestMetricsFor(ctx context.Context, def *requestMetrics) *requestMetrics {
+	if p, ok := ctx.Value(tenantContextKey{}).(*tenantProviders); ok {
+		return p.metrics
+	}
+	return def
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTenantRegistry returns a registry for at most one tenant at a time,
+// exporting to a collector that accepts everything, with run running.
+func newTestTenantRegistry(t *testing.T, processors ...sdktrace.SpanProcessor) *tenantRegistry {
+	t.Helper()
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(collector.Close)
+
+	target := newOTLPTarget(otlpProtocolHTTP, nil, strings.TrimPrefix(collector.URL, "http://"), nil)
+	cfg := testConfig()
+	cfg.Tenant.MaxProviders = 1
+	cfg.Tenant.IdleTimeout = time.Hour
+	reg := newTenantRegistry(resource.Empty(), target, sdktrace.AlwaysSample(), nil, processors, nil, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	go reg.run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		reg.Shutdown(context.Background())
+	})
+	return reg
+}
+
+// recording reports whether p's tracer provider still records spans, i.e.
+// has not been shut down.
+func recording(p *tenantProviders) bool {
+	_, span := p.tp.Tracer("test").Start(context.Background(), "probe")
+	defer span.End()
+	return span.IsRecording()
+}
+
+func TestTenantProvidersOutliveEvictionWhileInUse(t *testing.T) {
+	reg := newTestTenantRegistry(t)
+	ctx := context.Background()
+
+	a, err := reg.acquire(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Evicts a, which a request is still using
+	b, err := reg.acquire(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.release(b)
+	if !recording(a) {
+		t.Fatal("evicted providers shut down while in use")
+	}
+
+	reg.release(a)
+	deadline := time.Now().Add(5 * time.Second)
+	for recording(a) {
+		if time.Now().After(deadline) {
+			t.Fatal("evicted providers not shut down after their last request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTenantProvidersUseSharedProcessors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	reg := newTestTenantRegistry(t, recorder)
+
+	p, err := reg.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := p.tp.Tracer("test").Start(context.Background(), "request")
+	span.End()
+	reg.release(p)
+
+	if len(recorder.Ended()) != 1 {
+		t.Errorf("shared processor saw %d spans, want 1", len(recorder.Ended()))
+	}
+}
+
+func TestTenantMetricsScrapedWithTenantLabel(t *testing.T) {
+	reg := newTestTenantRegistry(t)
+	reg.cfg.MetricsExporter = metricsExporterPrometheus
+
+	p, err := reg.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.metrics.requests.Add(context.Background(), 1)
+	reg.release(p)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, l := range f.GetMetric()[0].GetLabel() {
+			if l.GetName() == "tenant_id" && l.GetValue() == "a" {
+				return
+			}
+		}
+		t.Fatalf("http_requests_total = %v, want a tenant_id label", f)
+	}
+	t.Fatal("http_requests_total not gathered")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Values of the trace_context attribute of incoming requests.
+const (
+	traceContextContinued = "continued" // a valid incoming trace context
+	traceContextInvalid   = "invalid"   // a traceparent that didn't parse
+	traceContextNew       = "new"       // no traceparent, a new trace
+)
+
+// withTraceContinuity counts requests by whether they continue a trace from
+// upstream, in http.server.incoming_trace_context.total. The share of
+// continued requests is the context continuity rate; a low one means
+// upstreams aren't propagating, which broken traces alone hardly show.
+func withTraceContinuity(meter metric.Meter, next http.Handler) (http.Handler, error) {
+	requests, err := meter.Int64Counter(
+		"http.server.incoming_trace_context.total",
+		metric.WithDescription("Number of requests by whether they arrived with a valid trace context"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := traceContextNew
+		if r.Header.Get("traceparent") != "" {
+			state = traceContextInvalid
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			if trace.SpanContextFromContext(ctx).IsValid() {
+				state = traceContextContinued
+			}
+		}
+		requests.Add(r.Context(), 1, metric.WithAttributes(attribute.String("trace_context", state)))
+		next.ServeHTTP(w, r)
+	}), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// truncationMarker ends every attribute value cut by truncateProcessor.
+const truncationMarker = "…[truncated]"
+
+// truncateValue returns v cut to max characters plus the marker, and whether
+// it was cut.
+func truncateValue(v string, max int) (string, bool) {
+	if utf8.RuneCountInString(v) <= max {
+		return v, false
+	}
+	runes := 0
+	for i := range v {
+		if runes == max {
+			return v[:i] + truncationMarker, true
+		}
+		runes++
+	}
+	return v, false
+}
+
+// truncateAttrs returns attrs with long string and string slice values
+// truncated, and whether any were.
+func truncateAttrs(attrs []attribute.KeyValue, max int) ([]attribute.KeyValue, bool) {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			if v, cut := truncateValue(kv.Value.AsString(), max); cut {
+				if out == nil {
+					out = append(make([]attribute.KeyValue, 0, len(attrs)), attrs...)
+				}
+				out[i] = kv.Key.String(v)
+			}
+		case attribute.STRINGSLICE:
+			values := kv.Value.AsStringSlice()
+			var cutAny bool
+			for j, s := range values {
+				if v, cut := truncateValue(s, max); cut {
+					values[j], cutAny = v, true
+				}
+			}
+			if cutAny {
+				if out == nil {
+					out = append(make([]attribute.KeyValue, 0, len(attrs)), attrs...)
+				}
+				out[i] = kv.Key.StringSlice(values)
+			}
+		}
+	}
+	if out == nil {
+		return attrs, false
+	}
+	return out, true
+}
+
+// truncateProcessor cuts long string attribute values on spans and their
+// events before passing ended spans to the export processor. Unlike the
+// SDK's own OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT it marks what it cut: each
+// value ends with truncationMarker, and the span gets truncated_attributes.
+type truncateProcessor struct {
+	next sdktrace.SpanProcessor
+	max  int
+}
+
+var _ sdktrace.SpanProcessor = (*truncateProcessor)(nil)
+
+func newTruncateProcessor(next sdktrace.SpanProcessor, max int) sdktrace.SpanProcessor {
+	return &truncateProcessor{next: next, max: max}
+}
+
+func (p *truncateProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *truncateProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(newTruncatedSpan(s, p.max))
+}
+
+func (p *truncateProcessor) Shutdown(ctx context.Context) error   { return p.next.Shutdown(ctx) }
+func (p *truncateProcessor) ForceFlush(ctx context.Context) error { return p.next.ForceFlush(ctx) }
+
+// truncatedSpan is a read-only view of a span with long attribute values
+// truncated.
+type truncatedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+}
+
+func newTruncatedSpan(s sdktrace.ReadOnlySpan, max int) sdktrace.ReadOnlySpan {
+	attrs, truncated := truncateAttrs(s.Attributes(), max)
+	events := s.Events()
+	out := make([]sdktrace.Event, len(events))
+	for i, e := range events {
+		var cut bool
+		e.Attributes, cut = truncateAttrs(e.Attributes, max)
+		truncated = truncated || cut
+		out[i] = e
+	}
+	if !truncated {
+		return s
+	}
+	attrs = append(attrs[:len(attrs):len(attrs)], attribute.Bool("truncated_attributes", true))
+	return &truncatedSpan{ReadOnlySpan: s, attrs: attrs, events: out}
+}
+
+func (s *truncatedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+func (s *truncatedSpan) Events() []sdktrace.Event         { return s.events }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// defaultRedactedQueryParams are query parameters that commonly carry
+// credentials.
+var defaultRedactedQueryParams = []string{
+	"access_token", "api_key", "apikey", "code", "key", "password",
+	"secret", "sig", "signature", "token",
+}
+
+// parseQueryParamDenylist parses a comma-separated list of query parameter
+// names, matched case-insensitively. An empty value yields the defaults.
+func parseQueryParamDenylist(v string) map[string]bool {
+	names := defaultRedactedQueryParams
+	if strings.TrimSpace(v) != "" {
+		names = strings.Split(v, ",")
+	}
+	denylist := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			denylist[strings.ToLower(name)] = true
+		}
+	}
+	return denylist
+}
+
+// redactQuery replaces the values of denylisted parameters in a raw query
+// string, keeping the order and encoding of everything else.
+func redactQuery(rawQuery string, denylist map[string]bool) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if hasValue && denylist[strings.ToLower(name)] {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// urlAttrs describes the request URL with the url.* semantic conventions,
+// with the values of the query parameters in denylist redacted.
+func urlAttrs(r *http.Request, denylist map[string]bool) []attribute.KeyValue {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	query := redactQuery(r.URL.RawQuery, denylist)
+
+	full := scheme + "://" + r.Host + r.URL.EscapedPath()
+	if query != "" {
+		full += "?" + query
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.URLFull(full),
+		semconv.URLScheme(scheme),
+		semconv.URLPath(r.URL.Path),
+	}
+	if query != "" {
+		attrs = append(attrs, semconv.URLQuery(query))
+	}
+	return attrs
+}
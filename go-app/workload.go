@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// simulateExternalWait blocks for d, or until ctx is done, as if waiting on a
+// remote call. The wait gets its own client span plus wait.start/wait.end
+// events, all with explicit timestamps, so Tempo shows the waiting time as a
+// distinct gap next to the compute time.
+func simulateExternalWait(ctx context.Context, tracer trace.Tracer, d time.Duration, peers map[string]string) {
+	start := time.Now()
+	_, span := startSpan(ctx, tracer, "external.wait",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(peerServiceAttrs(peers, "external.wait")...),
+		trace.WithTimestamp(start),
+	)
+	span.AddEvent("wait.start", trace.WithTimestamp(start))
+
+	timer := time.NewTimer(d)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	end := time.Now()
+	span.AddEvent("wait.end", trace.WithTimestamp(end))
+	span.SetAttributes(attribute.Float64("wait.duration_ms", toMillis(end.Sub(start))))
+	span.End(trace.WithTimestamp(end))
+}
+
+// gcCycles returns the number of completed GC cycles. Unlike
+// runtime.ReadMemStats it does not stop the world, so it is cheap enough to
+// call around every request's work loop.
+func gcCycles() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/cycles/total:gc-cycles"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// heapInUse returns the bytes occupied by live and not yet swept heap
+// objects, the runtime/metrics counterpart of MemStats.HeapAlloc. Like
+// gcCycles it does not stop the world, so it can be sampled on every work
+// loop iteration.
+func heapInUse() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// heapPeak tracks the highest heap size seen above a baseline.
+type heapPeak struct {
+	base uint64
+	peak uint64
+}
+
+func newHeapPeak() *heapPeak {
+	base := heapInUse()
+	return &heapPeak{base: base, peak: base}
+}
+
+// sample records the current heap size.
+func (h *heapPeak) sample() {
+	if n := heapInUse(); n > h.peak {
+		h.peak = n
+	}
+}
+
+// growth returns how far the heap peaked above the baseline. The heap is
+// shared, so concurrent requests inflate each other's growth.
+func (h *heapPeak) growth() int64 {
+	return int64(h.peak - h.base)
+}
+
+// workloadParams shapes the simulated work of one /hello request.
+type workloadParams struct {
+	iterations int // loop iterations
+	allocKB    int // KiB allocated per iteration
+	maxSleepMS int // upper bound, exclusive, of the random sleep per iteration
+}
+
+// defaultWorkload is the work a /hello request does without query params.
+var defaultWorkload = workloadParams{iterations: 100, allocKB: 1024, maxSleepMS: 10}
+
+// Caps on the workload query params, so a single request can't exhaust the
+// process.
+const (
+	maxWorkloadIterations = 100000
+	maxWorkloadAllocKB    = 64 * 1024
+	maxWorkloadSleepMS    = 1000
+
+	// Caps on the whole request, as each param can be within its own cap
+	// and still multiply out to hours of work
+	maxWorkloadTotalAllocKB = 4 << 20 // iterations × alloc_kb, 4 GiB
+	maxWorkloadTotalSleepMS = 60000   // iterations × max_sleep_ms
+)
+
+// parseWorkloadParams reads the iterations, alloc_kb and max_sleep_ms query
+// params. Absent, malformed or negative values fall back to the default;
+// values above their cap, or adding up to more than the per-request caps,
+// are an error.
+func parseWorkloadParams(q url.Values) (workloadParams, error) {
+	p := defaultWorkload
+	for _, param := range []struct {
+		name  string
+		max   int
+		value *int
+	}{
+		{"iterations", maxWorkloadIterations, &p.iterations},
+		{"alloc_kb", maxWorkloadAllocKB, &p.allocKB},
+		{"max_sleep_ms", maxWorkloadSleepMS, &p.maxSleepMS},
+	} {
+		n, err := strconv.Atoi(q.Get(param.name))
+		if err != nil || n < 0 {
+			continue
+		}
+		if n > param.max {
+			return workloadParams{}, fmt.Errorf("%s must be at most %d", param.name, param.max)
+		}
+		*param.value = n
+	}
+	if int64(p.iterations)*int64(p.allocKB) > maxWorkloadTotalAllocKB {
+		return workloadParams{}, fmt.Errorf("iterations × alloc_kb must be at most %d", maxWorkloadTotalAllocKB)
+	}
+	if int64(p.iterations)*int64(p.maxSleepMS) > maxWorkloadTotalSleepMS {
+		return workloadParams{}, fmt.Errorf("iterations × max_sleep_ms must be at most %d", maxWorkloadTotalSleepMS)
+	}
+	return p, nil
+}
+
+// attributes describes p for the request span.
+func (p workloadParams) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("workload.iterations", p.iterations),
+		attribute.Int("workload.alloc_kb", p.allocKB),
+		attribute.Int("workload.max_sleep_ms", p.maxSleepMS),
+	}
+}
+
+// sleep waits a random time below maxSleepMS.
+func (p workloadParams) sleep() {
+	if p.maxSleepMS > 0 {
+		time.Sleep(time.Duration(rand.Intn(p.maxSleepMS)) * time.Millisecond)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseWorkloadParams(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		want    workloadParams
+		wantErr bool
+	}{
+		{query: "", want: defaultWorkload},
+		{query: "iterations=5&alloc_kb=1&max_sleep_ms=0", want: workloadParams{iterations: 5, allocKB: 1}},
+		{query: "iterations=x&alloc_kb=-1", want: defaultWorkload},
+		{query: "iterations=100001", wantErr: true},
+		// Each within its cap, together far beyond a request's worth
+		{query: "iterations=100000&alloc_kb=65536&max_sleep_ms=0", wantErr: true},
+		{query: "iterations=100000&alloc_kb=0&max_sleep_ms=1000", wantErr: true},
+		{query: "iterations=60&alloc_kb=0&max_sleep_ms=1000", want: workloadParams{iterations: 60, maxSleepMS: 1000}},
+	} {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseWorkloadParams(q)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseWorkloadParams(%q) = %+v, want an error", tc.query, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseWorkloadParams(%q) = %+v, %v, want %+v", tc.query, got, err, tc.want)
+		}
+	}
+}